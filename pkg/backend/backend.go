@@ -0,0 +1,132 @@
+// Package backend abstracts the storages skbn copies files between, so that a copy
+// can be performed the same way whatever its source and destination are
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/utils"
+)
+
+// ErrNotFound is returned, wrapped, when the requested file does not exist
+var ErrNotFound = skbn.ErrNotFound
+
+// FileInfo holds the metadata of a single file
+type FileInfo = skbn.ObjectStat
+
+// Backend is a storage of files. Paths use "/" separators whatever the storage
+type Backend interface {
+	// List returns the paths of the files under path (recursive), relative to path
+	List(ctx context.Context, path string) ([]string, error)
+	// Download writes the content of the file at path to w
+	Download(ctx context.Context, path string, w io.Writer) error
+	// Upload writes the content read from r to the file at path, replacing it if it exists
+	Upload(ctx context.Context, path string, r io.Reader) error
+	// Delete deletes the file at path
+	Delete(ctx context.Context, path string) error
+	// Stat returns the metadata of the file at path, or an error wrapping ErrNotFound
+	Stat(ctx context.Context, path string) (*FileInfo, error)
+}
+
+// CopyOptions holds the options of a copy between two backends
+type CopyOptions struct {
+	// Concurrency is the number of files copied in parallel when copying a directory. Zero uses 10
+	Concurrency int
+}
+
+// CopyResult is the outcome of the copy of a single file
+type CopyResult struct {
+	SrcPath string
+	DstPath string
+	Err     error
+}
+
+// CopySummary is the outcome of a copy between two backends
+type CopySummary struct {
+	// Results holds the result of each file
+	Results []CopyResult
+	// Copied is the number of files copied
+	Copied int
+	// Failed is the number of files that could not be copied
+	Failed int
+}
+
+// Copy copies srcPath in src to dstPath in dst. If srcPath is a file, it is copied to dstPath.
+// Otherwise the files under srcPath are copied in parallel under dstPath, keeping their
+// relative paths. The content of each file is streamed from the download to the upload,
+// without holding the whole file in memory. The returned error lists the files that failed
+func Copy(ctx context.Context, src Backend, srcPath string, dst Backend, dstPath string, opts CopyOptions) (*CopySummary, error) {
+	var pairs []CopyResult
+	if _, err := src.Stat(ctx, srcPath); err == nil {
+		pairs = append(pairs, CopyResult{SrcPath: srcPath, DstPath: dstPath})
+	} else {
+		paths, lErr := src.List(ctx, srcPath)
+		if lErr != nil {
+			return nil, lErr
+		}
+		if len(paths) == 0 {
+			return nil, err
+		}
+		for _, p := range paths {
+			pairs = append(pairs, CopyResult{SrcPath: path.Join(srcPath, p), DstPath: path.Join(dstPath, p)})
+		}
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+	summary := &CopySummary{Results: pairs}
+	bwg := utils.NewBoundedWaitGroup(concurrency)
+	for i := range summary.Results {
+		if ctx.Err() != nil {
+			summary.Results[i].Err = ctx.Err()
+			continue
+		}
+		bwg.Add(1)
+		go func(r *CopyResult) {
+			defer bwg.Done()
+			r.Err = copyFile(ctx, src, r.SrcPath, dst, r.DstPath)
+		}(&summary.Results[i])
+	}
+	bwg.Wait()
+
+	var failed []string
+	for _, r := range summary.Results {
+		if r.Err != nil {
+			summary.Failed++
+			failed = append(failed, fmt.Sprintf("%s: %v", r.SrcPath, r.Err))
+		} else {
+			summary.Copied++
+		}
+	}
+	if len(failed) != 0 {
+		return summary, fmt.Errorf("could not copy %d of %d files: %s", len(failed), len(summary.Results), strings.Join(failed, ", "))
+	}
+	return summary, nil
+}
+
+// copyFile copies a single file from srcPath in src to dstPath in dst, streaming the
+// download into the upload. The pipe cannot be read again, so a failed upload is not retried
+func copyFile(ctx context.Context, src Backend, srcPath string, dst Backend, dstPath string) error {
+	pr, pw := io.Pipe()
+	downloadErr := make(chan error, 1)
+	go func() {
+		err := src.Download(ctx, srcPath, pw)
+		pw.CloseWithError(err)
+		downloadErr <- err
+	}()
+
+	err := dst.Upload(ctx, dstPath, pr)
+	// Unblock the download if the upload stopped reading
+	pr.CloseWithError(io.ErrClosedPipe)
+	if dErr := <-downloadErr; dErr != nil {
+		return dErr
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package backend_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/unfernandito/skbn/pkg/backend"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// tree is the content of the files copied, by path
+var tree = map[string][]byte{
+	"file.txt":           []byte("file"),
+	"empty":              {},
+	"dir/file.txt":       []byte("file in a directory"),
+	"dir/sub/deep.bin":   bytes.Repeat([]byte{0, 1, 2, 3}, 1024),
+	"dir/sub dir/café #": []byte("unusual name"),
+	// Larger than the threshold of a multipart upload to S3
+	"dir/large": bytes.Repeat([]byte("0123456789"), 1800*1024),
+}
+
+// writeTree writes tree under root
+func writeTree(t *testing.T, root string) {
+	t.Helper()
+	for p, content := range tree {
+		local := filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(local, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkTree fails t unless root holds exactly the files of tree
+func checkTree(t *testing.T, root string) {
+	t.Helper()
+	var got []string
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		got = append(got, filepath.ToSlash(rel))
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if want, ok := tree[filepath.ToSlash(rel)]; ok && !bytes.Equal(content, want) {
+			t.Errorf("got %d bytes in %s, want %d", len(content), rel, len(want))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for p := range tree {
+		want = append(want, p)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got files %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got files %q, want %q", got, want)
+		}
+	}
+}
+
+func TestCopyRoundTrip(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	tests := []struct {
+		name    string
+		through backend.Backend
+		path    string
+	}{
+		{"local", backend.NewLocal(t.TempDir()), "copy"},
+		{"S3", backend.NewS3(fake.Client()), "bucket/copy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srcDir, dstDir := t.TempDir(), t.TempDir()
+			writeTree(t, srcDir)
+			src, dst := backend.NewLocal(srcDir), backend.NewLocal(dstDir)
+
+			summary, err := backend.Copy(ctx, src, "", tt.through, tt.path, backend.CopyOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Copied != len(tree) {
+				t.Errorf("got %d files copied to %s, want %d", summary.Copied, tt.name, len(tree))
+			}
+			listed, err := tt.through.List(ctx, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(listed) != len(tree) {
+				t.Errorf("got files %q listed, want %d files", listed, len(tree))
+			}
+			if _, err := backend.Copy(ctx, tt.through, tt.path, dst, "", backend.CopyOptions{Concurrency: 2}); err != nil {
+				t.Fatal(err)
+			}
+			checkTree(t, dstDir)
+		})
+	}
+}
+
+func TestStatAndDelete(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	tests := []struct {
+		name string
+		b    backend.Backend
+		path string
+	}{
+		{"local", backend.NewLocal(t.TempDir()), "dir/file.txt"},
+		{"S3", backend.NewS3(fake.Client()), "bucket/dir/file.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if err := tt.b.Upload(ctx, tt.path, bytes.NewReader([]byte("content"))); err != nil {
+				t.Fatal(err)
+			}
+			info, err := tt.b.Stat(ctx, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size != int64(len("content")) {
+				t.Errorf("got size %d, want %d", info.Size, len("content"))
+			}
+			if err := tt.b.Delete(ctx, tt.path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tt.b.Stat(ctx, tt.path); !errors.Is(err, backend.ErrNotFound) {
+				t.Errorf("got error %v after deleting the file, want ErrNotFound", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+var _ Backend = (*Local)(nil)
+
+// Local is the Backend of the local file system. Paths use "/" separators like S3 keys,
+// and are relative to Root if it is set
+type Local struct {
+	Root string
+}
+
+// NewLocal returns the Backend of the local file system under root
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+// List returns the paths of the regular files under path (recursive), relative to path
+func (b *Local) List(ctx context.Context, path string) ([]string, error) {
+	root := b.localPath(path)
+	var paths []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, b.wrapNotExist(path, err)
+	}
+	return paths, nil
+}
+
+// Download writes the content of the file at path to w
+func (b *Local) Download(ctx context.Context, path string, w io.Writer) error {
+	f, err := os.Open(b.localPath(path))
+	if err != nil {
+		return b.wrapNotExist(path, err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, readerWithContext{ctx, f})
+	return err
+}
+
+// Upload writes the content read from r to the file at path, creating its directories as needed.
+// The content is written to a temporary file renamed once complete, so a failed upload
+// leaves any previous file in place
+func (b *Local) Upload(ctx context.Context, path string, r io.Reader) error {
+	localPath := b.localPath(path)
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, readerWithContext{ctx, r})
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), localPath)
+}
+
+// Delete deletes the file at path. A file that does not exist is considered deleted
+func (b *Local) Delete(ctx context.Context, path string) error {
+	if err := os.Remove(b.localPath(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stat returns the metadata of the file at path
+func (b *Local) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	info, err := os.Stat(b.localPath(path))
+	if err != nil {
+		return nil, b.wrapNotExist(path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	return &FileInfo{Size: info.Size(), LastModified: info.ModTime()}, nil
+}
+
+func (b *Local) localPath(path string) string {
+	return filepath.Join(b.Root, filepath.FromSlash(path))
+}
+
+func (b *Local) wrapNotExist(path string, err error) error {
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s: %w", path, ErrNotFound)
+	}
+	return err
+}
+
+// readerWithContext stops reading r once ctx is done
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (rc readerWithContext) Read(p []byte) (int, error) {
+	if err := rc.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return rc.r.Read(p)
+}
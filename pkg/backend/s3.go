@@ -0,0 +1,70 @@
+package backend
+
+import (
+	"context"
+	"io"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+)
+
+var _ Backend = (*S3)(nil)
+
+// S3 is the Backend of S3. Paths start with the bucket, such as bucket/dir/file
+type S3 struct {
+	Client *skbn.S3Client
+	// DownloadOptions holds the options of the downloads from S3
+	DownloadOptions skbn.S3DownloadOptions
+	// UploadOptions holds the options of the uploads to S3. The uploads of Copy stream the
+	// download through a pipe, which cannot be read again, so they are attempted once
+	UploadOptions skbn.S3UploadOptions
+	// DeleteOptions holds the options of the deletions from S3
+	DeleteOptions skbn.S3DeleteOptions
+	// ListOptions holds the options of the listings of S3
+	ListOptions skbn.S3ListOptions
+}
+
+// NewS3 returns the Backend of S3 using client, with the default options
+func NewS3(client *skbn.S3Client) *S3 {
+	return &S3{Client: client}
+}
+
+// List returns the paths of the files under path (recursive), relative to path
+func (b *S3) List(ctx context.Context, path string) ([]string, error) {
+	infos, err := b.Client.List(ctx, path, b.ListOptions)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(infos))
+	for _, info := range infos {
+		paths = append(paths, info.Key)
+	}
+	return paths, nil
+}
+
+// Download writes the content of the file at path to w
+func (b *S3) Download(ctx context.Context, path string, w io.Writer) error {
+	_, err := b.Client.Download(ctx, path, w, b.DownloadOptions)
+	return err
+}
+
+// Upload writes the content read from r to the file at path. The upload is attempted
+// again on a transient failure only if r is seekable, such as an *os.File
+func (b *S3) Upload(ctx context.Context, path string, r io.Reader) error {
+	opts := b.UploadOptions
+	if _, ok := r.(io.Seeker); !ok {
+		// Another attempt would upload the rest of r as if it were the whole file
+		opts.Retry.MaxAttempts = 1
+	}
+	_, err := b.Client.Upload(ctx, path, "", r, opts)
+	return err
+}
+
+// Delete deletes the file at path
+func (b *S3) Delete(ctx context.Context, path string) error {
+	return b.Client.Delete(ctx, path, b.DeleteOptions)
+}
+
+// Stat returns the metadata of the file at path
+func (b *S3) Stat(ctx context.Context, path string) (*FileInfo, error) {
+	return b.Client.Stat(ctx, path)
+}
@@ -44,7 +44,10 @@ func GetListOfFilesFromAbs(ctx context.Context, iClient interface{}, path string
 		return nil, err
 	}
 	a, c, p := initAbsVariables(pSplit)
-	pl := iClient.(pipeline.Pipeline)
+	pl, err := absPipelineFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
 	cu, err := getContainerURL(pl, a, c)
 	if err != nil {
 		return nil, err
@@ -77,7 +80,10 @@ func DownloadFromAbs(ctx context.Context, iClient interface{}, path string, writ
 		return err
 	}
 	a, c, p := initAbsVariables(pSplit)
-	pl := iClient.(pipeline.Pipeline)
+	pl, err := absPipelineFrom(iClient)
+	if err != nil {
+		return err
+	}
 	cu, err := getContainerURL(pl, a, c)
 	if err != nil {
 		return err
@@ -112,7 +118,10 @@ func UploadToAbs(ctx context.Context, iClient interface{}, toPath, fromPath stri
 	}
 
 	a, c, p := initAbsVariables(pSplit)
-	pl := iClient.(pipeline.Pipeline)
+	pl, err := absPipelineFrom(iClient)
+	if err != nil {
+		return err
+	}
 	cu, err := getContainerURL(pl, a, c)
 	if err != nil {
 		return err
@@ -218,3 +227,12 @@ func containerExists(list []azblob.ContainerItem, containerName string) bool {
 	}
 	return exists
 }
+
+// absPipelineFrom returns the pipeline of iClient, or an error if it is not one
+func absPipelineFrom(iClient interface{}) (pipeline.Pipeline, error) {
+	pl, ok := iClient.(pipeline.Pipeline)
+	if !ok || pl == nil {
+		return nil, fmt.Errorf("expected a pipeline.Pipeline as the client to Azure Blob Storage, got %T", iClient)
+	}
+	return pl, nil
+}
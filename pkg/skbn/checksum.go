@@ -0,0 +1,309 @@
+package skbn
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// checksum describes how a checksum of the content of a file is computed and encoded
+type checksum struct {
+	newHash func() hash.Hash
+	encode  func([]byte) string
+	decode  func(string) ([]byte, error)
+}
+
+// etagChecksum is the ETag of a file that is not encrypted with SSE-KMS or SSE-C
+var etagChecksum = checksum{md5.New, hex.EncodeToString, hex.DecodeString}
+
+// s3Checksums are the additional checksums S3 can store with a file, by algorithm
+var s3Checksums = map[string]checksum{
+	string(types.ChecksumAlgorithmCrc32):  {func() hash.Hash { return crc32.NewIEEE() }, base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString},
+	string(types.ChecksumAlgorithmCrc32c): {func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }, base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString},
+	string(types.ChecksumAlgorithmSha1):   {sha1.New, base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString},
+	string(types.ChecksumAlgorithmSha256): {sha256.New, base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString},
+}
+
+// sum returns the encoded checksum of b
+func (c checksum) sum(b []byte) string {
+	h := c.newHash()
+	h.Write(b)
+	return c.encode(h.Sum(nil))
+}
+
+// parts returns the number of parts of a checksum of a multipart file ("<checksum>-<parts>"),
+// and 0 for the checksum of a single part file. It returns false if value is not a checksum
+func (c checksum) parts(value string) (int, bool) {
+	sum, parts, multipart := strings.Cut(value, "-")
+	if b, err := c.decode(sum); err != nil || len(b) != c.newHash().Size() {
+		return 0, false
+	}
+	if !multipart {
+		return 0, true
+	}
+	n, err := strconv.Atoi(parts)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// maxPendingVerifyBytes caps the content held by a contentVerifier until the writes before it
+// come, about as much as a few parts of each of the downloads in parallel
+var maxPendingVerifyBytes int64 = 64 * 1024 * 1024
+
+// contentVerifier computes the checksum of the content written to w, to compare it with
+// the checksum of the downloaded file. Writes may come out of order from a concurrent
+// downloader, so the ones past the next offset are held until the gap is filled. Past
+// maxPendingVerifyBytes held, they are dropped and the content is read back from src once
+// written, if set with readBack. It is safe for concurrent use if w is
+type contentVerifier struct {
+	w        io.WriterAt
+	checksum checksum
+	partSize int64 // size of the parts of a multipart file, 0 for a single part file
+	src      io.ReaderAt
+	size     int64
+
+	mu       sync.Mutex
+	next     int64
+	pending  map[int64][]byte
+	pendingN int64
+	overflow bool
+	part     hash.Hash
+	partN    int64
+	sums     []byte
+	parts    int
+}
+
+func newContentVerifier(w io.WriterAt, c checksum, partSize int64) *contentVerifier {
+	cv := &contentVerifier{w: w, checksum: c, partSize: partSize}
+	cv.reset()
+	return cv
+}
+
+func (cv *contentVerifier) WriteAt(p []byte, off int64) (int, error) {
+	n, err := cv.w.WriteAt(p, off)
+	if n <= 0 {
+		return n, err
+	}
+
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	written := p[:n]
+	switch {
+	case cv.overflow:
+	case off > cv.next:
+		if cv.src != nil && cv.pendingN+int64(n) > maxPendingVerifyBytes {
+			cv.overflow = true
+			cv.pending, cv.pendingN = nil, 0
+			break
+		}
+		cv.pending[off] = append([]byte(nil), written...)
+		cv.pendingN += int64(n)
+	case off+int64(n) > cv.next:
+		cv.feed(written[cv.next-off:])
+		for {
+			b, ok := cv.pending[cv.next]
+			if !ok {
+				break
+			}
+			delete(cv.pending, cv.next)
+			cv.pendingN -= int64(len(b))
+			cv.feed(b)
+		}
+	}
+	return n, err
+}
+
+// readBack sets src to read the size bytes of content written from, to compute their checksum
+// once written, instead of holding more than maxPendingVerifyBytes of out of order writes
+func (cv *contentVerifier) readBack(src io.ReaderAt, size int64) {
+	cv.mu.Lock()
+	cv.src, cv.size = src, size
+	cv.mu.Unlock()
+}
+
+// feed hashes b, the content at the next offset
+func (cv *contentVerifier) feed(b []byte) {
+	cv.next += int64(len(b))
+	if cv.partSize <= 0 {
+		cv.part.Write(b)
+		return
+	}
+	for len(b) > 0 {
+		chunk := b
+		if rest := cv.partSize - cv.partN; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		cv.part.Write(chunk)
+		cv.partN += int64(len(chunk))
+		b = b[len(chunk):]
+		if cv.partN == cv.partSize {
+			cv.endPart()
+		}
+	}
+}
+
+func (cv *contentVerifier) endPart() {
+	cv.sums = cv.part.Sum(cv.sums)
+	cv.parts++
+	cv.part.Reset()
+	cv.partN = 0
+}
+
+func (cv *contentVerifier) reset() {
+	cv.mu.Lock()
+	cv.restart()
+	cv.mu.Unlock()
+}
+
+// restart forgets the content hashed and held so far
+func (cv *contentVerifier) restart() {
+	cv.next = 0
+	cv.pending = make(map[int64][]byte)
+	cv.pendingN = 0
+	cv.overflow = false
+	cv.part = cv.checksum.newHash()
+	cv.partN = 0
+	cv.sums = nil
+	cv.parts = 0
+}
+
+// sum returns the checksum of the content written so far, reading it back from src if
+// out of order writes were dropped
+func (cv *contentVerifier) sum() (string, error) {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if cv.overflow {
+		cv.restart()
+		buf := make([]byte, 1024*1024)
+		r := io.NewSectionReader(cv.src, 0, cv.size)
+		for {
+			n, err := r.Read(buf)
+			cv.feed(buf[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", fmt.Errorf("could not read back the content: %w", err)
+			}
+		}
+	}
+	if cv.partSize <= 0 {
+		return cv.checksum.encode(cv.part.Sum(nil)), nil
+	}
+	sums, parts := cv.sums, cv.parts
+	if cv.partN > 0 {
+		sums = cv.part.Sum(sums)
+		parts++
+	}
+	return cv.checksum.sum(sums) + "-" + strconv.Itoa(parts), nil
+}
+
+// verify returns an error wrapping ErrChecksumMismatch if the content does not have the given checksum
+func (cv *contentVerifier) verify(expected string) error {
+	got, err := cv.sum()
+	if err != nil {
+		return err
+	}
+	if got != expected {
+		return fmt.Errorf("expected checksum %s, got %s: %w", expected, got, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// objectVerifier verifies the content of a downloaded file against an expected checksum
+type objectVerifier struct {
+	*contentVerifier
+	expected string
+}
+
+// newObjectVerifier returns a verifier of the content written to w against the checksum
+// stored with the file using algorithm, if set and available, or else against its ETag.
+// It returns nil if the file has no checksum of its content
+func newObjectVerifier(ctx context.Context, svc S3API, bucket, key, versionID, algorithm string, payer types.RequestPayer, sseKey []byte, head *s3.HeadObjectOutput, w io.WriterAt, logger Logger) (*objectVerifier, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		RequestPayer: payer,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomerHeaders(sseKey)
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	if algorithm != "" {
+		input.ChecksumMode = types.ChecksumModeEnabled
+		out, err := svc.HeadObject(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("could not get the checksum of s3://%s/%s: %w", bucket, key, err)
+		}
+		if expected := objectChecksum(out, algorithm); expected != "" {
+			return newPartedVerifier(ctx, svc, input, s3Checksums[algorithm], expected, w, logger)
+		}
+		// Endpoints without additional checksums, such as older MinIO, do not return any
+		logger.Infof("s3://%s/%s has no %s checksum, verifying its ETag instead", bucket, key, algorithm)
+	}
+
+	// The ETag of a file encrypted with SSE-KMS or SSE-C is not the MD5 of its content
+	if sse := head.ServerSideEncryption; (sse != "" && sse != types.ServerSideEncryptionAes256) || head.SSECustomerAlgorithm != nil {
+		logger.Infof("Skipping checksum verification of s3://%s/%s: the ETag of an encrypted file is not a checksum", bucket, key)
+		return nil, nil
+	}
+	return newPartedVerifier(ctx, svc, input, etagChecksum, strings.Trim(aws.ToString(head.ETag), `"`), w, logger)
+}
+
+// newPartedVerifier returns a verifier of the content written to w against expected,
+// which is a checksum of the parts of the file described by input if it is a multipart file
+func newPartedVerifier(ctx context.Context, svc S3API, input *s3.HeadObjectInput, c checksum, expected string, w io.WriterAt, logger Logger) (*objectVerifier, error) {
+	bucket, key := aws.ToString(input.Bucket), aws.ToString(input.Key)
+	parts, ok := c.parts(expected)
+	if !ok {
+		logger.Infof("Skipping checksum verification of s3://%s/%s: %s is not a checksum", bucket, key, expected)
+		return nil, nil
+	}
+	if parts == 0 {
+		return &objectVerifier{newContentVerifier(w, c, 0), expected}, nil
+	}
+
+	// The parts of a multipart file all have the size of the first one, except the last one
+	input.PartNumber = aws.Int32(1)
+	part, err := svc.HeadObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the part size of s3://%s/%s: %w", bucket, key, err)
+	}
+	return &objectVerifier{newContentVerifier(w, c, aws.ToInt64(part.ContentLength)), expected}, nil
+}
+
+func (ov *objectVerifier) verify() error {
+	return ov.contentVerifier.verify(ov.expected)
+}
+
+// objectChecksum returns the checksum of head using algorithm, if any
+func objectChecksum(head *s3.HeadObjectOutput, algorithm string) string {
+	switch types.ChecksumAlgorithm(algorithm) {
+	case types.ChecksumAlgorithmCrc32:
+		return aws.ToString(head.ChecksumCRC32)
+	case types.ChecksumAlgorithmCrc32c:
+		return aws.ToString(head.ChecksumCRC32C)
+	case types.ChecksumAlgorithmSha1:
+		return aws.ToString(head.ChecksumSHA1)
+	case types.ChecksumAlgorithmSha256:
+		return aws.ToString(head.ChecksumSHA256)
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package skbn
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+)
+
+func TestContentVerifierOutOfOrder(t *testing.T) {
+	defer func(max int64) { maxPendingVerifyBytes = max }(maxPendingVerifyBytes)
+	maxPendingVerifyBytes = 10
+
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	sum := md5.Sum(content)
+	want := hex.EncodeToString(sum[:])
+	tests := []struct {
+		name         string
+		readBack     bool
+		writes       [][2]int // start and end of each write
+		wantOverflow bool
+	}{
+		{"in order", false, [][2]int{{0, 12}, {12, 24}, {24, 36}}, false},
+		{"held within the cap", false, [][2]int{{6, 12}, {0, 6}, {24, 36}, {12, 24}}, false},
+		{"held without a source to read back", false, [][2]int{{24, 36}, {12, 24}, {0, 12}}, false},
+		{"read back past the cap", true, [][2]int{{24, 36}, {12, 24}, {0, 12}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := manager.NewWriteAtBuffer(nil)
+			cv := newContentVerifier(w, etagChecksum, 0)
+			if tt.readBack {
+				cv.readBack(bytes.NewReader(content), int64(len(content)))
+			}
+			for _, wr := range tt.writes {
+				if _, err := cv.WriteAt(content[wr[0]:wr[1]], int64(wr[0])); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if cv.overflow != tt.wantOverflow {
+				t.Errorf("got overflow %v, want %v", cv.overflow, tt.wantOverflow)
+			}
+			if cv.src != nil && cv.pendingN > maxPendingVerifyBytes {
+				t.Errorf("got %d bytes held, want at most %d", cv.pendingN, maxPendingVerifyBytes)
+			}
+			if err := cv.verify(want); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
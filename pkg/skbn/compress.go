@@ -0,0 +1,58 @@
+package skbn
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// contentEncodingGzip is the Content-Encoding of gzip compressed files
+const contentEncodingGzip = "gzip"
+
+// newGzipReader returns a reader of the content of r compressed with gzip.
+// Closing it stops the compression if the content is not read until its end
+func newGzipReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, r)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// isGzipEncoded reports whether a file with the Content-Encoding encoding is compressed with gzip
+func isGzipEncoded(encoding string) bool {
+	for _, e := range strings.Split(encoding, ",") {
+		if strings.TrimSpace(e) == contentEncodingGzip {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadDecompressed downloads the file of input with a single request, and writes
+// its content decompressed with gzip to w, in order. It returns the number of bytes written
+func (c *S3Client) downloadDecompressed(ctx context.Context, input *s3.GetObjectInput, w io.WriterAt) (int64, error) {
+	// Keep the HTTP client from negotiating and decoding the compression itself
+	out, err := c.svc.GetObject(ctx, input, withHeaders("skbnAcceptEncoding", map[string]string{
+		"Accept-Encoding": "identity",
+	}, "GetObject"))
+	if err != nil {
+		return 0, err
+	}
+	defer out.Body.Close()
+
+	gz, err := gzip.NewReader(out.Body)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	return io.Copy(io.NewOffsetWriter(w, 0), gz)
+}
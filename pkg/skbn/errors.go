@@ -0,0 +1,215 @@
+package skbn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ErrChecksumMismatch is returned when downloaded content does not match the checksum of the object
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrPreconditionFailed is returned when a conditional upload finds that the object already exists
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// ErrNotModified is returned when a conditional download finds that the object did not change
+var ErrNotModified = errors.New("object not modified")
+
+// ErrRangeNotSatisfiable is returned when downloading a range that starts past the end of the object
+var ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// ErrObjectArchived is returned when downloading an object archived in the GLACIER or
+// DEEP_ARCHIVE storage class that is not restored, see RestoreFromGlacier
+var ErrObjectArchived = errors.New("object archived")
+
+// ErrAccessDenied is returned when the credentials are not allowed to do the requested operation
+var ErrAccessDenied = errors.New("access denied")
+
+// ErrBucketNotFound is returned when the requested bucket does not exist
+var ErrBucketNotFound = errors.New("bucket not found")
+
+// ErrNoCredentials is returned when no AWS credentials could be found or retrieved
+var ErrNoCredentials = errors.New("no credentials")
+
+// ErrRegionMismatch is returned when the bucket is in another region than the one of the client
+var ErrRegionMismatch = errors.New("region mismatch")
+
+// ErrIncompleteListing is returned when a listing with ConsistentListAfterWrite still lists
+// fewer files than expected once its attempts are exhausted
+var ErrIncompleteListing = errors.New("incomplete listing")
+
+// MultiError is the error of an operation on many files that went on past the failure of some
+// of them. errors.Is and errors.As match any of its errors
+type MultiError struct {
+	// Errors are the errors of the files that failed, each naming its file
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(e.Errors), strings.Join(msgs, ", "))
+}
+
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// s3ErrorSentinel returns the error of this package matching err, the error of operation, if any
+func s3ErrorSentinel(operation string, err error) error {
+	code, status := s3ErrorCode(err), s3StatusCode(err)
+	switch {
+	case code == "NoSuchBucket", operation == "HeadBucket" && status == http.StatusNotFound:
+		return ErrBucketNotFound
+	case code == "NoSuchKey", code == "NoSuchVersion", code == "NotFound":
+		return ErrNotFound
+	case code == "AccessDenied", status == http.StatusForbidden:
+		return ErrAccessDenied
+	case code == "PermanentRedirect", code == "AuthorizationHeaderMalformed", status == http.StatusMovedPermanently:
+		return ErrRegionMismatch
+	}
+	return nil
+}
+
+// mapS3Error wraps err, the error of operation, with the matching error of this package,
+// so that it can be matched with errors.Is while keeping the details of the S3 error
+func mapS3Error(operation string, err error) error {
+	sentinel := s3ErrorSentinel(operation, err)
+	if sentinel == nil || errors.Is(err, sentinel) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", sentinel, err)
+}
+
+// mapErrors is the client option mapping the errors of all operations to the errors of this package
+func mapErrors(o *s3.Options) {
+	if _, anonymous := o.Credentials.(aws.AnonymousCredentials); o.Credentials != nil && !anonymous {
+		o.Credentials = credentialsErrorMapper{o.Credentials}
+	}
+	o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+		if _, ok := stack.Initialize.Get("skbnErrors"); ok {
+			return nil
+		}
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("skbnErrors", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			if err != nil {
+				err = mapS3Error(middleware.GetOperationName(ctx), err)
+			}
+			return out, metadata, err
+		}), middleware.After)
+	})
+}
+
+// credentialsErrorMapper wraps the failures to retrieve credentials with ErrNoCredentials
+type credentialsErrorMapper struct {
+	aws.CredentialsProvider
+}
+
+func (p credentialsErrorMapper) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.CredentialsProvider.Retrieve(ctx)
+	if err != nil && !errors.Is(err, ErrNoCredentials) {
+		err = fmt.Errorf("%w: %w", ErrNoCredentials, err)
+	}
+	return creds, err
+}
+
+// isS3NotFound reports whether err is an S3 error for a missing object
+func isS3NotFound(err error) bool {
+	if s3StatusCode(err) == http.StatusNotFound {
+		return true
+	}
+	switch s3ErrorCode(err) {
+	case "NotFound", "NoSuchKey":
+		return true
+	}
+	return false
+}
+
+// isS3RangeNotSatisfiable reports whether err is an S3 error for a range starting past the end of a file
+func isS3RangeNotSatisfiable(err error) bool {
+	return s3StatusCode(err) == http.StatusRequestedRangeNotSatisfiable || s3ErrorCode(err) == "InvalidRange"
+}
+
+// isS3PreconditionFailed reports whether err is an S3 error for a failed If-Match or If-None-Match
+// condition, including when it is the cause of a failed multipart upload
+func isS3PreconditionFailed(err error) bool {
+	return s3StatusCode(err) == http.StatusPreconditionFailed
+}
+
+// isS3NotModified reports whether err is an S3 error for a failed If-None-Match or
+// If-Modified-Since condition of a download
+func isS3NotModified(err error) bool {
+	return s3StatusCode(err) == http.StatusNotModified
+}
+
+// isS3ObjectArchived reports whether err is an S3 error for reading an archived object that is not restored
+func isS3ObjectArchived(err error) bool {
+	return s3ErrorCode(err) == "InvalidObjectState"
+}
+
+// s3StatusCode returns the HTTP status code of the S3 request that failed with err.
+// It returns 0 if there is none
+func s3StatusCode(err error) int {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+// RequestIDs returns the request ID (x-amz-request-id) and host ID (x-amz-id-2) of the S3
+// request that failed with err, which AWS support asks for to investigate a failure.
+// They are empty if err is not the error of an S3 response
+func RequestIDs(err error) (requestID, hostID string) {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		requestID = respErr.ServiceRequestID()
+	}
+	var hostErr interface{ ServiceHostID() string }
+	if errors.As(err, &hostErr) {
+		hostID = hostErr.ServiceHostID()
+	}
+	return requestID, hostID
+}
+
+// requestIDsSuffix returns the request IDs of err to append to a log line, or "" if it has none
+func requestIDsSuffix(err error) string {
+	requestID, hostID := RequestIDs(err)
+	if requestID == "" && hostID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (request ID: %s, host ID: %s)", requestID, hostID)
+}
+
+// withRequestIDs returns err with its request IDs appended to its message, unless the message
+// already holds them, as the errors of S3 responses do until wrapped by another error
+func withRequestIDs(err error) error {
+	requestID, hostID := RequestIDs(err)
+	msg := err.Error()
+	if (requestID == "" || strings.Contains(msg, requestID)) && (hostID == "" || strings.Contains(msg, hostID)) {
+		return err
+	}
+	return fmt.Errorf("%w%s", err, requestIDsSuffix(err))
+}
+
+// s3ErrorCode returns the code of the S3 error err, such as NoSuchKey, or "" if there is none
+func s3ErrorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
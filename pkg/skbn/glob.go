@@ -0,0 +1,75 @@
+package skbn
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// keyFilter selects keys with include and exclude glob patterns
+type keyFilter struct {
+	include []string
+	exclude []string
+}
+
+// newKeyFilter returns a filter of keys matching any of include (or all keys if it is empty)
+// and none of exclude. Patterns use the syntax of path.Match, where ** also matches any
+// number of directories. A pattern without a slash matches the base name of a key
+func newKeyFilter(include, exclude []string) (*keyFilter, error) {
+	for _, pattern := range append(append([]string(nil), include...), exclude...) {
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return &keyFilter{include: include, exclude: exclude}, nil
+}
+
+func (kf *keyFilter) match(key string) bool {
+	if kf == nil {
+		return true
+	}
+	for _, pattern := range kf.exclude {
+		if matchGlob(pattern, key) {
+			return false
+		}
+	}
+	if len(kf.include) == 0 {
+		return true
+	}
+	for _, pattern := range kf.include {
+		if matchGlob(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether key matches pattern
+func matchGlob(pattern, key string) bool {
+	if !strings.Contains(pattern, "/") {
+		key = path.Base(key)
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(key, "/"))
+}
+
+func matchSegments(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Match any number of segments, including none
+			for i := 0; i <= len(key); i++ {
+				if matchSegments(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(key) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], key[0]); !ok {
+			return false
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
@@ -61,7 +61,10 @@ func GetClientToK8s() (*K8sClient, error) {
 
 // GetListOfFilesFromK8s gets list of files in path from Kubernetes (recursive)
 func GetListOfFilesFromK8s(iClient interface{}, path, findType, findName string) ([]string, error) {
-	client := *iClient.(*K8sClient)
+	client, err := k8sClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
 	pSplit := strings.Split(path, "/")
 	if err := validateK8sPath(pSplit); err != nil {
 		return nil, err
@@ -78,7 +81,7 @@ func GetListOfFilesFromK8s(iClient interface{}, path, findType, findName string)
 		stderr, err := Exec(client, namespace, podName, containerName, command, nil, output)
 		if len(stderr) != 0 {
 			if attempt == attempts {
-				return nil, fmt.Errorf("STDERR: " + (string)(stderr))
+				return nil, fmt.Errorf("STDERR: %s", stderr)
 			}
 			utils.Sleep(attempt)
 			continue
@@ -107,7 +110,10 @@ func GetListOfFilesFromK8s(iClient interface{}, path, findType, findName string)
 
 // DownloadFromK8s downloads a single file from Kubernetes
 func DownloadFromK8s(iClient interface{}, path string, writer io.Writer, verbose bool) error {
-	client := *iClient.(*K8sClient)
+	client, err := k8sClientFrom(iClient)
+	if err != nil {
+		return err
+	}
 	pSplit := strings.Split(path, "/")
 	if err := validateK8sPath(pSplit); err != nil {
 		return err
@@ -133,7 +139,7 @@ func DownloadFromK8s(iClient interface{}, path string, writer io.Writer, verbose
 			log.Printf("this was last attempt")
 			if len(stderr) != 0 {
 				log.Printf("STDERR: %s", stderr)
-				return fmt.Errorf("STDERR: " + (string)(stderr))
+				return fmt.Errorf("STDERR: %s", stderr)
 			}
 			if err != nil {
 				log.Printf("Error: %v", err)
@@ -151,7 +157,10 @@ func DownloadFromK8s(iClient interface{}, path string, writer io.Writer, verbose
 
 // UploadToK8s uploads a single file to Kubernetes
 func UploadToK8s(iClient interface{}, toPath, fromPath string, reader io.Reader, verbose bool) error {
-	client := *iClient.(*K8sClient)
+	client, err := k8sClientFrom(iClient)
+	if err != nil {
+		return err
+	}
 	pSplit := strings.Split(toPath, "/")
 	if err := validateK8sPath(pSplit); err != nil {
 		return err
@@ -172,7 +181,7 @@ func UploadToK8s(iClient interface{}, toPath, fromPath string, reader io.Reader,
 
 		if len(stderr) != 0 {
 			if attempt == attempts {
-				return fmt.Errorf("STDERR: " + (string)(stderr))
+				return fmt.Errorf("STDERR: %s", stderr)
 			}
 			utils.Sleep(attempt)
 			continue
@@ -190,7 +199,7 @@ func UploadToK8s(iClient interface{}, toPath, fromPath string, reader io.Reader,
 
 		if len(stderr) != 0 {
 			if attempt == attempts {
-				return fmt.Errorf("STDERR: " + (string)(stderr))
+				return fmt.Errorf("STDERR: %s", stderr)
 			}
 			utils.Sleep(attempt)
 			continue
@@ -208,7 +217,7 @@ func UploadToK8s(iClient interface{}, toPath, fromPath string, reader io.Reader,
 
 		if len(stderr) != 0 {
 			if attempt == attempts {
-				return fmt.Errorf("STDERR: " + (string)(stderr))
+				return fmt.Errorf("STDERR: %s", stderr)
 			}
 			utils.Sleep(attempt)
 			continue
@@ -296,3 +305,12 @@ func initK8sVariables(split []string) (string, string, string, string) {
 func getAbsPath(path ...string) string {
 	return filepath.Join("/", filepath.Join(path...))
 }
+
+// k8sClientFrom returns the client of iClient, or an error if it is not a *K8sClient
+func k8sClientFrom(iClient interface{}) (K8sClient, error) {
+	client, ok := iClient.(*K8sClient)
+	if !ok || client == nil {
+		return K8sClient{}, fmt.Errorf("expected a *K8sClient as the client to Kubernetes, got %T", iClient)
+	}
+	return *client, nil
+}
@@ -0,0 +1,46 @@
+package skbn
+
+import (
+	"log"
+)
+
+// Logger receives the progress reported by the S3 operations
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// StdLogger returns a Logger writing to the standard logger of the log package
+func StdLogger() Logger {
+	return stdLogger{}
+}
+
+// NopLogger returns a Logger discarding everything
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// resolveLogger returns logger if set. Otherwise it returns
+// the standard logger if verbose is set, and a no-op logger if not
+func resolveLogger(logger Logger, verbose bool) Logger {
+	if logger != nil {
+		return logger
+	}
+	if verbose {
+		return StdLogger()
+	}
+	return NopLogger()
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) { log.Printf(format, args...) }
+func (stdLogger) Infof(format string, args ...interface{})  { log.Printf(format, args...) }
+func (stdLogger) Errorf(format string, args ...interface{}) { log.Printf(format, args...) }
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
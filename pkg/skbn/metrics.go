@@ -0,0 +1,44 @@
+package skbn
+
+import (
+	"time"
+)
+
+// Metrics receives measurements of the S3 operations, to be exported by a metrics library
+// such as Prometheus. op is the operation, such as "upload", "download" or "list"
+type Metrics interface {
+	// ObserveTransfer is called when an operation succeeds, with the bytes it transferred
+	ObserveTransfer(op string, bytes int64, duration time.Duration)
+	// IncRetry is called when a failed attempt of an operation is retried
+	IncRetry(op string)
+	// IncError is called when an operation fails
+	IncError(op string)
+}
+
+// NopMetrics returns Metrics discarding everything
+func NopMetrics() Metrics {
+	return nopMetrics{}
+}
+
+// resolveMetrics returns metrics if set, and no-op metrics if not
+func resolveMetrics(metrics Metrics) Metrics {
+	if metrics != nil {
+		return metrics
+	}
+	return NopMetrics()
+}
+
+// observe reports the outcome of an operation to metrics
+func observe(metrics Metrics, op string, bytes int64, duration time.Duration, err error) {
+	if err != nil {
+		metrics.IncError(op)
+		return
+	}
+	metrics.ObserveTransfer(op, bytes, duration)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveTransfer(op string, bytes int64, duration time.Duration) {}
+func (nopMetrics) IncRetry(op string)                                             {}
+func (nopMetrics) IncError(op string)                                             {}
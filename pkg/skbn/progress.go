@@ -0,0 +1,144 @@
+package skbn
+
+import (
+	"io"
+	"sync"
+)
+
+// ProgressFunc is called during a transfer with the number of bytes transferred so far
+// and the total number of bytes to transfer, which is -1 when it is unknown
+type ProgressFunc func(bytesSoFar, totalBytes int64)
+
+// countingReader counts the bytes read from r and reports them to progress, if set
+type countingReader struct {
+	r        io.Reader
+	n        int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.n += int64(n)
+		if cr.progress != nil {
+			cr.progress(cr.n, cr.total)
+		}
+	}
+	return n, err
+}
+
+// countingWriterAt counts the bytes written to w and reports them to progress, if set.
+// It is safe for concurrent use if w is
+type countingWriterAt struct {
+	w        io.WriterAt
+	mu       sync.Mutex
+	n        int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (cw *countingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := cw.w.WriteAt(p, off)
+	if n > 0 {
+		cw.mu.Lock()
+		cw.n += int64(n)
+		if cw.progress != nil {
+			cw.progress(cw.n, cw.total)
+		}
+		cw.mu.Unlock()
+	}
+	return n, err
+}
+
+func (cw *countingWriterAt) reset() {
+	cw.mu.Lock()
+	cw.n = 0
+	cw.mu.Unlock()
+}
+
+// countingReaderAt is a countingReader over the section of a seekable file that keeps ReadAt
+// and Seek, so that the uploader reads its parts through its BufferProvider. Parts are read
+// again to sign and retry them, so bytes are only counted the first time they are read.
+// ReadAt is safe for concurrent use
+type countingReaderAt struct {
+	*io.SectionReader
+	mu       sync.Mutex
+	read     []byteRange
+	n        int64
+	total    int64
+	progress ProgressFunc
+}
+
+// byteRange is the range of bytes from start to end, excluded
+type byteRange struct {
+	start, end int64
+}
+
+func (cr *countingReaderAt) Read(p []byte) (int, error) {
+	off, err := cr.SectionReader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	n, err := cr.SectionReader.Read(p)
+	cr.count(off, n)
+	return n, err
+}
+
+func (cr *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.SectionReader.ReadAt(p, off)
+	cr.count(off, n)
+	return n, err
+}
+
+// count adds the n bytes read at off to the ranges read so far, merging the ranges they
+// overlap or touch, and counts those not read before
+func (cr *countingReaderAt) count(off int64, n int) {
+	if n <= 0 {
+		return
+	}
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	added := byteRange{off, off + int64(n)}
+	ranges := make([]byteRange, 0, len(cr.read)+1)
+	inserted := false
+	for _, r := range cr.read {
+		switch {
+		case r.end < added.start:
+			ranges = append(ranges, r)
+		case r.start > added.end:
+			if !inserted {
+				ranges = append(ranges, added)
+				inserted = true
+			}
+			ranges = append(ranges, r)
+		default:
+			cr.n -= r.end - r.start
+			added.start, added.end = min(added.start, r.start), max(added.end, r.end)
+		}
+	}
+	if !inserted {
+		ranges = append(ranges, added)
+	}
+	cr.n += added.end - added.start
+	cr.read = ranges
+	if cr.progress != nil {
+		cr.progress(cr.n, cr.total)
+	}
+}
+
+// reset rewinds the section and forgets the bytes read, before another attempt
+func (cr *countingReaderAt) reset() error {
+	cr.mu.Lock()
+	cr.read, cr.n = nil, 0
+	cr.mu.Unlock()
+	_, err := cr.SectionReader.Seek(0, io.SeekStart)
+	return err
+}
+
+// bytesRead returns the number of distinct bytes read so far
+func (cr *countingReaderAt) bytesRead() int64 {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.n
+}
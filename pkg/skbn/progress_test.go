@@ -0,0 +1,43 @@
+package skbn
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCountingReaderAt(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads [][2]int64 // offset and length of each ReadAt
+		want  int64
+	}{
+		{"sequential", [][2]int64{{0, 3}, {3, 3}, {6, 4}}, 10},
+		{"read again", [][2]int64{{0, 5}, {0, 5}, {0, 5}}, 5},
+		{"out of order", [][2]int64{{6, 4}, {0, 3}, {3, 3}}, 10},
+		{"overlapping", [][2]int64{{2, 4}, {0, 3}, {5, 2}}, 7},
+		{"gaps", [][2]int64{{0, 2}, {8, 2}, {4, 2}}, 6},
+		{"bridging a gap", [][2]int64{{0, 2}, {8, 2}, {1, 8}}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported int64
+			cr := &countingReaderAt{
+				SectionReader: io.NewSectionReader(bytes.NewReader([]byte("0123456789")), 0, 10),
+				total:         10,
+				progress:      func(bytesSoFar, _ int64) { reported = bytesSoFar },
+			}
+			for _, r := range tt.reads {
+				if _, err := cr.ReadAt(make([]byte, r[1]), r[0]); err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+			}
+			if got := cr.bytesRead(); got != tt.want || reported != tt.want {
+				t.Errorf("got %d bytes counted and %d reported, want %d", got, reported, tt.want)
+			}
+			if err := cr.reset(); err != nil || cr.bytesRead() != 0 {
+				t.Errorf("got %d bytes counted after a reset (error %v), want 0", cr.bytesRead(), err)
+			}
+		})
+	}
+}
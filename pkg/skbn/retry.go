@@ -0,0 +1,238 @@
+package skbn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/unfernandito/skbn/pkg/utils"
+)
+
+// RetryConfig controls how many times an operation is attempted and how long to wait between attempts.
+// Only transient failures are attempted again, see isRetryable
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// BaseDelay is the delay after the first failed attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts
+	MaxDelay time.Duration
+	// Multiplier is applied to the delay after each failed attempt
+	Multiplier float64
+	// Jitter randomizes each delay between half and all of its value
+	Jitter bool
+	// ThrottleDelay replaces BaseDelay after an attempt throttled by S3, such as with SlowDown.
+	// It also grows by Multiplier up to MaxDelay, but is always randomized so that parallel
+	// operations do not retry together. A longer Retry-After of the response is waited instead
+	ThrottleDelay time.Duration
+}
+
+// DefaultRetryConfig returns the retry configuration used when none is set:
+// 3 attempts, waiting 1 second after the first and 2 seconds after the second,
+// or around 5 and 10 seconds when throttled
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts:   3,
+		BaseDelay:     time.Second,
+		MaxDelay:      30 * time.Second,
+		Multiplier:    2,
+		ThrottleDelay: 5 * time.Second,
+	}
+}
+
+// withDefaults fills the unset fields of rc from DefaultRetryConfig
+func (rc RetryConfig) withDefaults() RetryConfig {
+	def := DefaultRetryConfig()
+	if rc.MaxAttempts <= 0 {
+		rc.MaxAttempts = def.MaxAttempts
+	}
+	if rc.BaseDelay <= 0 {
+		rc.BaseDelay = def.BaseDelay
+	}
+	if rc.MaxDelay <= 0 {
+		rc.MaxDelay = def.MaxDelay
+	}
+	if rc.Multiplier < 1 {
+		rc.Multiplier = def.Multiplier
+	}
+	if rc.ThrottleDelay <= 0 {
+		rc.ThrottleDelay = def.ThrottleDelay
+	}
+	return rc
+}
+
+// delay returns how long to wait after the given failed attempt (starting at 1)
+func (rc RetryConfig) delay(attempt int) time.Duration {
+	d := float64(rc.BaseDelay) * math.Pow(rc.Multiplier, float64(attempt-1))
+	if d > float64(rc.MaxDelay) {
+		d = float64(rc.MaxDelay)
+	}
+	if rc.Jitter {
+		d = d/2 + rand.Float64()*d/2
+	}
+	return time.Duration(d)
+}
+
+// throttleDelay returns how long to wait after the given attempt (starting at 1) was throttled
+// with err, at least the Retry-After of the response if any
+func (rc RetryConfig) throttleDelay(attempt int, err error) time.Duration {
+	throttled := rc
+	throttled.BaseDelay = rc.ThrottleDelay
+	throttled.Jitter = true
+	d := throttled.delay(attempt)
+	if after := retryAfter(err); after > d {
+		d = after
+	}
+	return d
+}
+
+// wait sleeps after the given attempt failed with err, returning early if ctx is done
+func (rc RetryConfig) wait(ctx context.Context, logger Logger, attempt int, err error) error {
+	d := rc.delay(attempt)
+	if isThrottled(err) {
+		d = rc.throttleDelay(attempt, err)
+		logger.Infof("Throttled by S3, waiting %s before the next attempt", d)
+	}
+	return utils.SleepDurationWithContext(ctx, d)
+}
+
+// do calls fn until it succeeds, fails with an error that is not retryable, the attempts
+// are exhausted or ctx is done, waiting between attempts. desc describes the operation in the logs
+func (rc RetryConfig) do(ctx context.Context, logger Logger, desc string, fn func() error) error {
+	return rc.doWithMetrics(ctx, logger, NopMetrics(), "", desc, fn)
+}
+
+// doWithMetrics is do, also counting the retries of op in metrics
+func (rc RetryConfig) doWithMetrics(ctx context.Context, logger Logger, metrics Metrics, op, desc string, fn func() error) error {
+	rc = rc.withDefaults()
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		logger.Debugf("Attempt %d to %s", attempt, desc)
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		logger.Errorf("Attempt %d to %s failed%s: %v", attempt, desc, requestIDsSuffix(err), err)
+		if !isRetryable(err) {
+			logger.Errorf("This error is not retryable")
+			return withRequestIDs(err)
+		}
+		if attempt >= rc.MaxAttempts {
+			logger.Errorf("This was last attempt")
+			return withRequestIDs(err)
+		}
+		if err := rc.wait(ctx, logger, attempt, err); err != nil {
+			return err
+		}
+		metrics.IncRetry(op)
+	}
+}
+
+// s3Retryables are the checks of the SDK for the S3 errors worth another attempt:
+// connection errors and resets, timeouts, throttling such as SlowDown and 5xx responses
+var s3Retryables = retry.IsErrorRetryables(retry.DefaultRetryables)
+
+// permanentErrors are the errors of this package that another attempt would return again
+var permanentErrors = []error{
+	ErrNotFound,
+	ErrBucketNotFound,
+	ErrAccessDenied,
+	ErrNoCredentials,
+	ErrRegionMismatch,
+	ErrPreconditionFailed,
+	ErrNotModified,
+	ErrRangeNotSatisfiable,
+	ErrObjectArchived,
+}
+
+// isRetryable reports whether an operation that failed with err may succeed if attempted again.
+// Failures with a response, such as 403 or 404, are only retried for throttling and server errors,
+// and failures without one only for connection errors, timeouts and truncated responses
+func isRetryable(err error) bool {
+	for _, permanent := range permanentErrors {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if retryable := s3Retryables.IsErrorRetryable(err); retryable != aws.UnknownTernary {
+		return retryable.Bool()
+	}
+	if s3ErrorCode(err) == "InternalError" {
+		// Returned with a 200 response when S3 fails to complete a multipart upload
+		return true
+	}
+	if status := s3StatusCode(err); status != 0 {
+		return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// s3Throttles are the checks of the SDK for the S3 errors asking to slow down
+var s3Throttles = retry.IsErrorThrottles(retry.DefaultThrottles)
+
+// isThrottled reports whether err is S3 asking to slow down, with SlowDown or another
+// throttling error, or a 429 or 503 response
+func isThrottled(err error) bool {
+	if s3Throttles.IsErrorThrottle(err) == aws.TrueTernary {
+		return true
+	}
+	status := s3StatusCode(err)
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// retryAfter returns the delay of the Retry-After header of the S3 response that failed
+// with err, either in seconds or as a date. It returns 0 if there is none
+func retryAfter(err error) time.Duration {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.Response == nil {
+		return 0
+	}
+	value := respErr.Response.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// withTimeout returns ctx with a deadline timeout from now, for the Timeout of an operation
+// across all its attempts. It returns ctx itself if timeout is not positive
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError returns err wrapping context.DeadlineExceeded, and naming the timeout, if the
+// operation failed because opCtx, derived from ctx with withTimeout, reached its deadline
+func timeoutError(ctx, opCtx context.Context, timeout time.Duration, err error) error {
+	if err == nil || ctx.Err() != nil || opCtx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return fmt.Errorf("timed out after %s: %w: %w", timeout, context.DeadlineExceeded, err)
+}
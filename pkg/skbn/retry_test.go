@@ -0,0 +1,103 @@
+package skbn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// responseError returns the error of an S3 response with status and header
+func responseError(status int, header http.Header) error {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status, Header: header}},
+		Err:      fmt.Errorf("%d response", status),
+	}}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", responseError(http.StatusInternalServerError, nil), true},
+		{"unavailable", responseError(http.StatusServiceUnavailable, nil), true},
+		{"too many requests", responseError(http.StatusTooManyRequests, nil), true},
+		{"slow down", &smithy.GenericAPIError{Code: "SlowDown"}, true},
+		{"internal error of a 200 response", &smithy.GenericAPIError{Code: "InternalError"}, true},
+		{"truncated response", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{"forbidden", responseError(http.StatusForbidden, nil), false},
+		{"not found response", responseError(http.StatusNotFound, nil), false},
+		{"not found", fmt.Errorf("s3://bucket/key: %w", ErrNotFound), false},
+		{"precondition failed", fmt.Errorf("s3://bucket/key: %w", ErrPreconditionFailed), false},
+		{"canceled", fmt.Errorf("upload: %w", context.Canceled), false},
+		{"other error", errors.New("invalid argument"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		min, max time.Duration
+	}{
+		{"seconds", responseError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"7"}}), 7 * time.Second, 7 * time.Second},
+		{"date", responseError(http.StatusServiceUnavailable, http.Header{"Retry-After": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}), 58 * time.Minute, time.Hour},
+		{"zero", responseError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"0"}}), 0, 0},
+		{"invalid", responseError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"soon"}}), 0, 0},
+		{"no header", responseError(http.StatusServiceUnavailable, nil), 0, 0},
+		{"no response", errors.New("connection reset"), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.err); got < tt.min || got > tt.max {
+				t.Errorf("got %s, want between %s and %s", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestThrottleDelay(t *testing.T) {
+	rc := RetryConfig{ThrottleDelay: 4 * time.Second, MaxDelay: 20 * time.Second}.withDefaults()
+	slowDown := responseError(http.StatusServiceUnavailable, nil)
+	tests := []struct {
+		name     string
+		attempt  int
+		err      error
+		min, max time.Duration
+	}{
+		{"first attempt", 1, slowDown, 2 * time.Second, 4 * time.Second},
+		{"second attempt", 2, slowDown, 4 * time.Second, 8 * time.Second},
+		{"capped", 5, slowDown, 10 * time.Second, 20 * time.Second},
+		{"longer Retry-After", 1, responseError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"60"}}), time.Minute, time.Minute},
+		{"shorter Retry-After", 1, responseError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}}), 2 * time.Second, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The delay is randomized, so it is checked several times
+			for i := 0; i < 20; i++ {
+				if got := rc.throttleDelay(tt.attempt, tt.err); got < tt.min || got > tt.max {
+					t.Fatalf("got %s, want between %s and %s", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
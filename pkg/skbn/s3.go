@@ -1,76 +1,751 @@
 package skbn
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
-	"net/http"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/unfernandito/skbn/pkg/utils"
+)
+
+// S3Config holds the configuration used to create a client to S3
+type S3Config struct {
+	// Retry controls the attempts made to connect to S3
+	Retry RetryConfig
+	// ConnectionCheck is how the connection to the bucket is checked.
+	// Defaults to AWS_S3_CONNECTION_CHECK, then to S3ConnectionCheckHeadBucket
+	ConnectionCheck S3ConnectionCheck
+	// Logger receives the connection attempts. Nothing is logged if it is not set
+	Logger Logger
+
+	// Region is the region of the bucket. Defaults to AWS_REGION, then to AWS_DEFAULT_REGION,
+	// then to the region of the shared config profile, then to DefaultRegion
+	Region string
+	// DefaultRegion is the region used when none is set by Region, the environment or the
+	// shared config profile. Defaults to AWS_S3_DEFAULT_REGION, then to us-east-1
+	DefaultRegion string
+	// Endpoint is the URL of an S3 compatible store, such as Minio. Defaults to AWS_S3_ENDPOINT,
+	// then to the standard AWS_ENDPOINT_URL_S3 and AWS_ENDPOINT_URL, unless
+	// AWS_IGNORE_CONFIGURED_ENDPOINT_URLS is set. With an endpoint from any of them, buckets
+	// are accessed with path style unless VirtualHostedStyle is set, the region defaults to
+	// us-east-1 and checksums are only sent and validated when an operation requires them,
+	// as many stores do not support them
+	Endpoint string
+	// DisableSSL connects to the endpoint over HTTP. Defaults to AWS_S3_NO_SSL
+	DisableSSL bool
+	// ForcePathStyle uses path style bucket access. It is always used with Endpoint, unless
+	// VirtualHostedStyle is set. Defaults to AWS_S3_FORCE_PATH_STYLE
+	ForcePathStyle bool
+	// VirtualHostedStyle uses virtual hosted style bucket access with Endpoint, for stores
+	// serving buckets as subdomains. Defaults to AWS_S3_VIRTUAL_HOSTED_STYLE
+	VirtualHostedStyle bool
+	// UseAccelerate uses the S3 Transfer Acceleration endpoint, which must be enabled on
+	// the bucket. It cannot be combined with Endpoint. Defaults to AWS_S3_USE_ACCELERATE
+	UseAccelerate bool
+	// UseDualStack uses the IPv6 dual-stack endpoint. Defaults to AWS_S3_USE_DUALSTACK
+	UseDualStack bool
+
+	// HTTPClient sends the requests to S3 and STS. Nil uses the client of the SDK, tuned by the
+	// transport options below, which cannot be combined with HTTPClient
+	HTTPClient *http.Client
+	// TLSConfig configures the TLS connections, such as with the root CAs of an on-premises store.
+	// Nil uses the system roots
+	TLSConfig *tls.Config
+	// CABundlePath is a PEM file of the CAs to trust, such as the private CA of an on-premises store,
+	// in addition to the roots of TLSConfig or of the system. Certificates are still verified,
+	// unlike with DisableSSL. The SDK also reads such a file from AWS_CA_BUNDLE
+	CABundlePath string
+	// CACertPEM holds PEM encoded CAs to trust, like CABundlePath
+	CACertPEM []byte
+	// ProxyURL is the URL of the HTTP proxy to connect through.
+	// Defaults to HTTPS_PROXY and HTTP_PROXY, for the hosts not listed by NO_PROXY
+	ProxyURL string
+	// MaxIdleConns is the number of idle connections kept open, across all hosts. Zero uses 100
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the number of idle connections kept open to each host. Zero uses 10
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost limits the connections open to each host. Zero does not limit them
+	MaxConnsPerHost int
+
+	// Profile is the shared config profile to use from ~/.aws/config and ~/.aws/credentials,
+	// including its region and role settings. Defaults to AWS_PROFILE
+	Profile string
+
+	// DisableEC2Metadata does not look up credentials from the EC2 instance metadata service,
+	// so that a host without other credentials fails fast with ErrNoCredentials.
+	// Defaults to AWS_EC2_METADATA_DISABLED
+	DisableEC2Metadata bool
+	// EC2MetadataTimeout bounds each request to the EC2 instance metadata service, which hosts
+	// other than EC2 do not answer. Defaults to AWS_METADATA_SERVICE_TIMEOUT in seconds, then to 1 second
+	EC2MetadataTimeout time.Duration
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	// AssumeRoleARN is the IAM role to assume with STS. The credentials of the role
+	// are refreshed automatically before they expire. Defaults to AWS_ASSUME_ROLE_ARN
+	AssumeRoleARN string
+	// AssumeRoleExternalID is the external id required by the role, if any.
+	// Defaults to AWS_ASSUME_ROLE_EXTERNAL_ID
+	AssumeRoleExternalID string
+	// AssumeRoleSessionName identifies the role session. Defaults to
+	// AWS_ASSUME_ROLE_SESSION_NAME, or a name generated by the SDK
+	AssumeRoleSessionName string
+}
+
+// MinIOConfig returns the configuration of a client to the MinIO server, or other S3 compatible
+// store, at endpoint, such as http://localhost:9000. The credentials are the access key and
+// secret key of the store, read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+func MinIOConfig(endpoint string) S3Config {
+	return S3Config{
+		Endpoint:       endpoint,
+		DisableSSL:     strings.HasPrefix(endpoint, "http://"),
+		ForcePathStyle: true,
+		Region:         "us-east-1",
+	}
+}
+
+// S3ConnectionCheck is how the connection to a bucket is checked when creating its client
+type S3ConnectionCheck string
+
+const (
+	// S3ConnectionCheckList lists the bucket, which requires s3:ListBucket on it.
+	// When the bucket is in another region than configured, the client switches to that region
+	S3ConnectionCheckList S3ConnectionCheck = "list"
+	// S3ConnectionCheckHeadBucket gets the head of the bucket, which also requires s3:ListBucket on it.
+	// When the bucket is in another region than configured, the client switches to that region
+	S3ConnectionCheckHeadBucket S3ConnectionCheck = "head-bucket"
+	// S3ConnectionCheckNone only builds the client. No permission is needed until the first
+	// operation, for clients limited to s3:GetObject or s3:PutObject on some keys
+	S3ConnectionCheckNone S3ConnectionCheck = "none"
 )
 
+// S3ObjectInfo holds the metadata of an object listed from S3
+type S3ObjectInfo struct {
+	// Key is the object key relative to the listed path
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// ETag is the entity tag of the object, without surrounding quotes
+	ETag         string
+	StorageClass string
+}
+
+// ObjectStat holds the metadata of a single object in S3
+type ObjectStat struct {
+	Size        int64
+	ContentType string
+	// ETag is the entity tag of the object, without surrounding quotes
+	ETag         string
+	LastModified time.Time
+}
+
+// TransferResult holds the outcome of a single file transfer
+type TransferResult struct {
+	// BytesTransferred is the number of bytes transferred by the last attempt
+	BytesTransferred int64
+	// Duration is the time taken by the transfer, including all attempts
+	Duration time.Duration
+	// Attempts is the number of attempts made
+	Attempts int
+}
+
+// UploadResult holds the outcome of a single file upload
+type UploadResult struct {
+	TransferResult
+	// Key is the key of the uploaded file, including the file name appended to a path of a bucket only
+	Key string
+	// ETag is the entity tag of the uploaded file, without surrounding quotes
+	ETag string
+	// VersionID is the version of the uploaded file, on versioned buckets
+	VersionID string
+	// Location is the URL of the uploaded file
+	Location string
+}
+
+// S3ListOptions holds the options of a listing of files from S3
+type S3ListOptions struct {
+	// ListObjectsV1 uses the legacy ListObjects API instead of ListObjectsV2,
+	// for S3 compatible stores that do not support the latter
+	ListObjectsV1 bool
+	// Include lists the glob patterns of the relative paths to list, such as *.json or
+	// 2024/**/*.parquet. Empty lists all files
+	Include []string
+	// Exclude lists the glob patterns of the relative paths not to list
+	Exclude []string
+	// Limit stops the listing after this number of files. Zero lists all files.
+	// With Sort, all files are listed and the first ones in the order of Sort are kept
+	Limit int
+	// Sort orders the files once they are all listed: S3SortNatural or S3SortNewestFirst.
+	// Empty keeps the lexicographic order of the keys returned by S3, without sorting.
+	// It is not supported by the pages of GetFileInfoPageFromS3
+	Sort string
+	// ConsistentListAfterWrite lists the files again while fewer than ExpectedCount are listed,
+	// for S3 compatible stores whose listings can miss the files just written. The files are
+	// listed up to Retry.MaxAttempts times, waiting with the backoff of Retry in between. If
+	// still fewer are listed, they are returned with an error wrapping ErrIncompleteListing.
+	// It is not supported by the pages of GetFileInfoPageFromS3
+	ConsistentListAfterWrite bool
+	// ExpectedCount is the number of files the listing should return with
+	// ConsistentListAfterWrite, such as the number of files just uploaded
+	ExpectedCount int
+	// Logger receives the explanation of each listing done again with ConsistentListAfterWrite.
+	// Nothing is logged if it is not set
+	Logger Logger
+	// Retry controls the attempts made to list the files
+	Retry RetryConfig
+	// Metrics receives the outcome of the listing as operation "list", with 0 bytes
+	Metrics Metrics
+	// RequesterPays acknowledges that the requests to a Requester Pays bucket are charged
+	// to the requester. Requests to such a bucket are denied without it
+	RequesterPays bool
+}
+
+// S3ListPage is a page of files of the listing of a path in S3
+type S3ListPage struct {
+	Files []S3ObjectInfo
+	// NextToken continues the listing after this page. It is empty on the last page
+	NextToken string
+}
+
+// S3DownloadOptions holds the options of a single file download from S3
+type S3DownloadOptions struct {
+	// Verbose logs the progress of the download with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Retry controls the attempts made to download the file
+	Retry RetryConfig
+	// Timeout bounds the whole download, including all its attempts and the waits between them.
+	// Once exceeded the download is aborted with an error wrapping context.DeadlineExceeded.
+	// Zero does not limit it
+	Timeout time.Duration
+	// Progress is called as the file is written. The size of the file is fetched
+	// before the download to report it as the total
+	Progress ProgressFunc
+	// VersionID downloads a specific version of the file from a versioned bucket
+	VersionID string
+	// Concurrency is the number of parts downloaded in parallel when the writer
+	// implements io.WriterAt, such as an *os.File. Other writers are written
+	// one part at a time. Zero uses the SDK default
+	Concurrency int
+	// VerifyChecksum compares the downloaded content with the ETag of the file, and fails
+	// with ErrChecksumMismatch if they differ. Files encrypted with SSE-KMS or SSE-C,
+	// whose ETag is not a checksum, are not verified. The content of a writer implementing
+	// io.ReaderAt, such as an *os.File, may be read back to verify it. Other writers are
+	// written one part at a time, whatever Concurrency
+	VerifyChecksum bool
+	// ChecksumAlgorithm verifies the content against the additional checksum S3 stores with
+	// the file, such as SHA256, instead of its ETag. Implies VerifyChecksum. Files without
+	// such a checksum, or from endpoints that do not support them, are verified by ETag
+	ChecksumAlgorithm string
+	// MaxBytesPerSecond limits the bandwidth of the whole download, across all its parts.
+	// Zero does not limit it
+	MaxBytesPerSecond int64
+	// Metrics receives the outcome of the download as operation "download"
+	Metrics Metrics
+	// IfNoneMatch only downloads the file if its ETag differs, such as the ETag of a local copy.
+	// Otherwise the download fails with ErrNotModified, without writing to the writer
+	IfNoneMatch string
+	// IfModifiedSince only downloads the file if it was modified after this time.
+	// Otherwise the download fails with ErrNotModified, without writing to the writer
+	IfModifiedSince time.Time
+	// Decompress writes the content of files with a gzip Content-Encoding decompressed.
+	// Such files are downloaded with a single request, and cannot be verified with VerifyChecksum
+	Decompress bool
+	// RequesterPays acknowledges that the requests to a Requester Pays bucket are charged
+	// to the requester. Requests to such a bucket are denied without it
+	RequesterPays bool
+	// SSECustomerKey is the 256-bit key the file was uploaded with using SSE-C encryption,
+	// which S3 does not store. Reading such a file fails without it
+	SSECustomerKey []byte
+}
+
+// S3DeleteOptions holds the options of a single file deletion from S3
+type S3DeleteOptions struct {
+	// Verbose logs the progress of the deletion with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Retry controls the attempts made to delete the file
+	Retry RetryConfig
+	// ErrorIfNotFound returns an error wrapping ErrNotFound when the file does not exist
+	ErrorIfNotFound bool
+	// DryRun logs the files that would be deleted instead of deleting them
+	DryRun bool
+}
+
 // GetClientToS3 checks the connection to S3 and returns the tested client
-func GetClientToS3(path string) (*session.Session, error) {
+func GetClientToS3(ctx context.Context, path string) (*s3.Client, error) {
+	return GetClientToS3WithConfig(ctx, path, S3Config{})
+}
+
+// GetClientToS3WithConfig checks the connection to S3 using config and returns the tested client
+func GetClientToS3WithConfig(ctx context.Context, path string, config S3Config) (*s3.Client, error) {
 	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
 	bucket, _ := initS3Variables(pSplit)
-	attempts := 3
-	attempt := 0
-	for attempt < attempts {
-		attempt++
+	logger := resolveLogger(config.Logger, false)
+	if boolOrEnv(config.UseAccelerate, "AWS_S3_USE_ACCELERATE") && resolveEndpoint(config) != "" {
+		return nil, fmt.Errorf("transfer acceleration cannot be used with a custom endpoint")
+	}
+	check := S3ConnectionCheck(stringOrEnv(string(config.ConnectionCheck), "AWS_S3_CONNECTION_CHECK"))
+	switch check {
+	case "":
+		check = S3ConnectionCheckHeadBucket
+	case S3ConnectionCheckList, S3ConnectionCheckHeadBucket, S3ConnectionCheckNone:
+	default:
+		return nil, fmt.Errorf("unsupported connection check %q", check)
+	}
 
-		s, err := getNewSession()
+	var svc *s3.Client
+	err := config.Retry.do(ctx, logger, fmt.Sprintf("connect to s3://%s", bucket), func() error {
+		var err error
+		svc, err = getNewClient(ctx, config, logger)
 		if err != nil {
-			if attempt == attempts {
-				return nil, err
-			}
-			utils.Sleep(attempt)
-			continue
+			return err
+		}
+		switch check {
+		case S3ConnectionCheckHeadBucket:
+			svc, err = checkBucketRegion(ctx, svc, bucket, logger, func(svc *s3.Client) error {
+				_, err := svc.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+				return err
+			})
+		case S3ConnectionCheckList:
+			svc, err = checkBucketRegion(ctx, svc, bucket, logger, func(svc *s3.Client) error {
+				_, err := svc.ListObjects(ctx, &s3.ListObjectsInput{
+					Bucket:  aws.String(bucket),
+					MaxKeys: aws.Int32(0),
+				})
+				return err
+			})
 		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to s3://%s: %w", bucket, err)
+	}
+
+	return svc, nil
+}
+
+// checkBucketRegion calls check of bucket with svc. When S3 answers that the bucket is in another
+// region, it is called again with a copy of svc in that region, which is returned
+func checkBucketRegion(ctx context.Context, svc *s3.Client, bucket string, logger Logger, check func(svc *s3.Client) error) (*s3.Client, error) {
+	err := check(svc)
+	var respErr *awshttp.ResponseError
+	if err == nil || !errors.As(err, &respErr) || svc.Options().BaseEndpoint != nil {
+		return svc, err
+	}
+	if code := respErr.HTTPStatusCode(); code != http.StatusMovedPermanently && code != http.StatusBadRequest {
+		return svc, err
+	}
+
+	current := svc.Options().Region
+	region := respErr.Response.Header.Get("X-Amz-Bucket-Region")
+	if region == "" {
+		region, _ = NewS3ClientFromService(svc).BucketRegion(ctx, bucket)
+	}
+	if region == "" || region == current {
+		return svc, err
+	}
+
+	logger.Infof("Bucket %s is in region %s, not %s, switching to it", bucket, region, current)
+	svc = s3.New(svc.Options(), func(o *s3.Options) {
+		o.Region = region
+	})
+	if err := check(svc); err != nil {
+		return nil, fmt.Errorf("bucket %s is in region %s: %w", bucket, region, err)
+	}
+	return svc, nil
+}
+
+// GetBucketRegion returns the region bucket is in. The region of iClient does not need to be the one of bucket
+func GetBucketRegion(ctx context.Context, iClient interface{}, bucket string) (string, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return "", err
+	}
+	return c.BucketRegion(ctx, bucket)
+}
 
-		_, err = s3.New(s).ListObjects(&s3.ListObjectsInput{
-			Bucket:  aws.String(bucket),
-			MaxKeys: aws.Int64(0),
+// BucketRegion returns the region bucket is in. The region of the client does not need to be the one of bucket
+func (c *S3Client) BucketRegion(ctx context.Context, bucket string) (string, error) {
+	if err := validateS3BucketName(bucket); err != nil {
+		return "", err
+	}
+	region, err := manager.GetBucketRegion(ctx, c.svc, bucket)
+	var notFound manager.BucketNotFound
+	if errors.As(err, &notFound) {
+		return "", fmt.Errorf("bucket %s: %w", bucket, ErrBucketNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get the region of bucket %s: %w", bucket, err)
+	}
+	return region, nil
+}
+
+// GetListOfFilesFromS3 gets list of files in path from S3 (recursive)
+func GetListOfFilesFromS3(ctx context.Context, iClient interface{}, path string) ([]string, error) {
+	return GetListOfFilesFromS3WithOptions(ctx, iClient, path, S3ListOptions{})
+}
+
+// GetListOfFilesFromS3WithOptions gets list of files in path from S3 (recursive) using opts
+func GetListOfFilesFromS3WithOptions(ctx context.Context, iClient interface{}, path string, opts S3ListOptions) ([]string, error) {
+	infos, err := GetFileInfoFromS3WithOptions(ctx, iClient, path, opts)
+	if err != nil && !errors.Is(err, ErrIncompleteListing) {
+		return nil, err
+	}
+
+	var outLines []string
+	for _, info := range infos {
+		outLines = append(outLines, info.Key)
+	}
+
+	return outLines, err
+}
+
+// GetListOfFilesFromS3Filtered gets list of files in path from S3 (recursive) matching any of
+// the glob patterns of include, or all files if it is empty, and none of exclude
+func GetListOfFilesFromS3Filtered(ctx context.Context, iClient interface{}, path string, include, exclude []string) ([]string, error) {
+	return GetListOfFilesFromS3WithOptions(ctx, iClient, path, S3ListOptions{Include: include, Exclude: exclude})
+}
+
+// GetFileInfoFromS3 gets list of files in path from S3 (recursive) along with their metadata
+func GetFileInfoFromS3(ctx context.Context, iClient interface{}, path string) ([]S3ObjectInfo, error) {
+	return GetFileInfoFromS3WithOptions(ctx, iClient, path, S3ListOptions{})
+}
+
+// GetFileInfoFromS3WithOptions gets list of files in path from S3 (recursive) along with their metadata using opts
+func GetFileInfoFromS3WithOptions(ctx context.Context, iClient interface{}, path string, opts S3ListOptions) ([]S3ObjectInfo, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.List(ctx, path, opts)
+}
+
+// List gets list of files in path from S3 (recursive) along with their metadata using opts
+func (c *S3Client) List(ctx context.Context, path string, opts S3ListOptions) ([]S3ObjectInfo, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+	filter, err := newKeyFilter(opts.Include, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateListSort(opts.Sort); err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if opts.Sort != "" {
+		// The files kept by the limit are the first ones once sorted, so all are listed
+		opts.Limit = 0
+	}
+
+	if opts.ConsistentListAfterWrite && opts.ExpectedCount > 0 && opts.Limit > 0 && opts.ExpectedCount > opts.Limit {
+		return nil, fmt.Errorf("the expected count of %d files is over the limit of %d files", opts.ExpectedCount, opts.Limit)
+	}
+
+	var infos []S3ObjectInfo
+	start := time.Now()
+	metrics := resolveMetrics(opts.Metrics)
+	desc := fmt.Sprintf("list files in s3://%s/%s", bucket, s3Path)
+	attempts := 0
+	ctx, span := startSpan(ctx, "skbn.GetListOfFilesFromS3", bucket, s3Path)
+	list := func() error {
+		return opts.Retry.doWithMetrics(ctx, NopLogger(), metrics, "list", desc, func() error {
+			attempts++
+			infos = nil
+			return listS3Objects(ctx, c.svc, bucket, s3Path, opts, func(obj types.Object) bool {
+				relativePath, ok := relativeS3Key(aws.ToString(obj.Key), s3Path)
+				if ok && filter.match(relativePath) {
+					infos = append(infos, newS3ObjectInfo(relativePath, obj))
+				}
+				return opts.Limit <= 0 || len(infos) < opts.Limit
+			})
 		})
-		if attempt == attempts {
+	}
+	err = list()
+	if err == nil && opts.ConsistentListAfterWrite && opts.ExpectedCount > 0 {
+		err = listUntilConsistent(ctx, bucket, s3Path, opts, &infos, list)
+	}
+	observe(metrics, "list", 0, time.Since(start), err)
+	endSpan(span, 0, attempts, err)
+	if err != nil && !errors.Is(err, ErrIncompleteListing) {
+		return nil, err
+	}
+
+	if opts.Sort != "" {
+		sortS3ObjectInfos(infos, opts.Sort)
+		if limit > 0 && len(infos) > limit {
+			infos = infos[:limit]
+		}
+	}
+	return infos, err
+}
+
+// listUntilConsistent calls list again, with the backoff of opts.Retry, while it lists fewer
+// files in infos than opts.ExpectedCount. It returns an error wrapping ErrIncompleteListing
+// if fewer are still listed once the attempts are exhausted
+func listUntilConsistent(ctx context.Context, bucket, prefix string, opts S3ListOptions, infos *[]S3ObjectInfo, list func() error) error {
+	logger := resolveLogger(opts.Logger, false)
+	retry := opts.Retry.withDefaults()
+	for attempt := 1; len(*infos) < opts.ExpectedCount; attempt++ {
+		if attempt >= retry.MaxAttempts {
+			return fmt.Errorf("listed %d files in s3://%s/%s after %d listings, expected %d: %w", len(*infos), bucket, prefix, attempt, opts.ExpectedCount, ErrIncompleteListing)
+		}
+		d := retry.delay(attempt)
+		logger.Infof("Listed %d files in s3://%s/%s, expected %d: the store may not list the files just written yet, listing again in %s (%d/%d)",
+			len(*infos), bucket, prefix, opts.ExpectedCount, d, attempt+1, retry.MaxAttempts)
+		if err := utils.SleepDurationWithContext(ctx, d); err != nil {
+			return err
+		}
+		if err := list(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFileInfoPageFromS3 gets a page of the files in path from S3 (recursive) along with their
+// metadata using opts, starting after the page token was returned with ("" for the first page).
+// A page holds up to opts.Limit files, or 1000 if zero, and fewer when filtered with patterns
+func GetFileInfoPageFromS3(ctx context.Context, iClient interface{}, path, token string, opts S3ListOptions) (*S3ListPage, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListPage(ctx, path, token, opts)
+}
+
+// ListPage gets a page of the files in path from S3 (recursive) along with their
+// metadata using opts, starting after the page token was returned with ("" for the first page).
+// A page holds up to opts.Limit files, or 1000 if zero, and fewer when filtered with patterns
+func (c *S3Client) ListPage(ctx context.Context, path, token string, opts S3ListOptions) (*S3ListPage, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+	filter, err := newKeyFilter(opts.Include, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Sort != "" {
+		return nil, errors.New("sorting needs the whole listing and is not supported by pages, list with GetFileInfoFromS3WithOptions")
+	}
+	if opts.ConsistentListAfterWrite {
+		return nil, errors.New("consistent listings after writes need the whole listing and are not supported by pages, list with GetFileInfoFromS3WithOptions")
+	}
+	maxKeys := int32(opts.Limit)
+	if maxKeys <= 0 || maxKeys > s3MaxListKeys {
+		maxKeys = s3MaxListKeys
+	}
+
+	var contents []types.Object
+	page := &S3ListPage{}
+	if useListObjectsV1(opts) {
+		input := &s3.ListObjectsInput{
+			Bucket:       aws.String(bucket),
+			Prefix:       aws.String(s3Path),
+			MaxKeys:      aws.Int32(maxKeys),
+			RequestPayer: requestPayer(opts.RequesterPays),
+		}
+		if token != "" {
+			input.Marker = aws.String(token)
+		}
+		out, err := c.svc.ListObjects(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		contents = out.Contents
+		// Without a delimiter, the next page starts after the last key of this one
+		if aws.ToBool(out.IsTruncated) && len(contents) != 0 {
+			page.NextToken = aws.ToString(contents[len(contents)-1].Key)
+		}
+	} else {
+		input := &s3.ListObjectsV2Input{
+			Bucket:       aws.String(bucket),
+			Prefix:       aws.String(s3Path),
+			MaxKeys:      aws.Int32(maxKeys),
+			RequestPayer: requestPayer(opts.RequesterPays),
+		}
+		if token != "" {
+			input.ContinuationToken = aws.String(token)
+		}
+		out, err := c.svc.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		contents = out.Contents
+		if aws.ToBool(out.IsTruncated) {
+			page.NextToken = aws.ToString(out.NextContinuationToken)
+		}
+	}
+
+	for _, obj := range contents {
+		relativePath, ok := relativeS3Key(aws.ToString(obj.Key), s3Path)
+		if ok && filter.match(relativePath) {
+			page.Files = append(page.Files, newS3ObjectInfo(relativePath, obj))
+		}
+	}
+
+	return page, nil
+}
+
+// listS3Objects calls fn for each object under prefix until fn returns false,
+// using ListObjectsV2 unless opts or AWS_S3_LIST_OBJECTS_V1 ask for ListObjects
+func listS3Objects(ctx context.Context, svc S3API, bucket, prefix string, opts S3ListOptions, fn func(obj types.Object) bool) error {
+	return listS3Pages(ctx, svc, bucket, prefix, "", opts, func(contents []types.Object, _ []types.CommonPrefix) bool {
+		for _, obj := range contents {
+			if !fn(obj) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// s3MaxListKeys is the maximum number of keys in a single page of a listing
+const s3MaxListKeys = 1000
+
+// listS3Pages calls fn for each page of the listing of prefix until fn returns false.
+// A delimiter groups the keys containing it after prefix into common prefixes
+func listS3Pages(ctx context.Context, svc S3API, bucket, prefix, delimiter string, opts S3ListOptions, fn func(contents []types.Object, prefixes []types.CommonPrefix) bool) error {
+	// Do not fetch more keys than needed when every key counts towards the limit
+	var maxKeys *int32
+	if opts.Limit > 0 && opts.Limit < s3MaxListKeys && len(opts.Include) == 0 && len(opts.Exclude) == 0 {
+		maxKeys = aws.Int32(int32(opts.Limit))
+	}
+
+	if useListObjectsV1(opts) {
+		input := &s3.ListObjectsInput{
+			Bucket:       aws.String(bucket),
+			Prefix:       aws.String(prefix),
+			MaxKeys:      maxKeys,
+			RequestPayer: requestPayer(opts.RequesterPays),
+		}
+		if delimiter != "" {
+			input.Delimiter = aws.String(delimiter)
+		}
+		for {
+			out, err := svc.ListObjects(ctx, input)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			if !fn(out.Contents, out.CommonPrefixes) || !aws.ToBool(out.IsTruncated) {
+				return nil
+			}
+			// NextMarker is only returned with a delimiter, otherwise the
+			// next page starts after the last key of this one
+			input.Marker = out.NextMarker
+			if input.Marker == nil && len(out.Contents) != 0 {
+				input.Marker = out.Contents[len(out.Contents)-1].Key
 			}
 		}
-		if err == nil {
-			return s, nil
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:       aws.String(bucket),
+		Prefix:       aws.String(prefix),
+		MaxKeys:      maxKeys,
+		RequestPayer: requestPayer(opts.RequesterPays),
+	}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	paginator := s3.NewListObjectsV2Paginator(svc, input)
+	for paginator.HasMorePages() {
+		out, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if !fn(out.Contents, out.CommonPrefixes) {
+			return nil
 		}
-		utils.Sleep(attempt)
 	}
+	return nil
+}
+
+// useListObjectsV1 reports whether opts or AWS_S3_LIST_OBJECTS_V1 ask for the legacy ListObjects API
+func useListObjectsV1(opts S3ListOptions) bool {
+	listV1 := opts.ListObjectsV1
+	if v1 := os.Getenv("AWS_S3_LIST_OBJECTS_V1"); v1 != "" && !listV1 {
+		listV1, _ = strconv.ParseBool(v1)
+	}
+	return listV1
+}
 
-	return nil, nil
+// S3DirListing is a directory style listing of a path in S3
+type S3DirListing struct {
+	// Keys are the files directly in the path, relative to it
+	Keys []string
+	// CommonPrefixes are the "directories" directly in the path, relative to it and
+	// ending with the delimiter
+	CommonPrefixes []string
 }
 
-// GetListOfFilesFromS3 gets list of files in path from S3 (recursive)
-func GetListOfFilesFromS3(iClient interface{}, path string) ([]string, error) {
-	s := iClient.(*session.Session)
+// ListObjectsWithDelimiter lists the files and "directories" directly in path (non recursive),
+// directories being the common prefixes of the keys up to the next delimiter, such as "/"
+func ListObjectsWithDelimiter(ctx context.Context, iClient interface{}, path, delimiter string) (*S3DirListing, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListWithDelimiter(ctx, path, delimiter)
+}
+
+// ListWithDelimiter lists the files and "directories" directly in path (non recursive),
+// directories being the common prefixes of the keys up to the next delimiter, such as "/"
+func (c *S3Client) ListWithDelimiter(ctx context.Context, path, delimiter string) (*S3DirListing, error) {
 	pSplit := strings.Split(path, "/")
-	if err := validateS3Path(pSplit); err != nil {
+	if err := validateS3Path(pSplit, false); err != nil {
 		return nil, err
 	}
+	if delimiter == "" {
+		return nil, fmt.Errorf("delimiter must not be empty")
+	}
 	bucket, s3Path := initS3Variables(pSplit)
+	// List the content of the path rather than the path itself
+	if s3Path != "" && !strings.HasSuffix(s3Path, delimiter) {
+		s3Path += delimiter
+	}
 
-	var outLines []string
-	err := s3.New(s).ListObjectsPages(&s3.ListObjectsInput{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(s3Path),
-	}, func(p *s3.ListObjectsOutput, last bool) (shouldContinue bool) {
-		for _, obj := range p.Contents {
-			line := *obj.Key
-			outLines = append(outLines, strings.Replace(line, s3Path, "", 1))
+	listing := &S3DirListing{}
+	err := listS3Pages(ctx, c.svc, bucket, s3Path, delimiter, S3ListOptions{}, func(contents []types.Object, prefixes []types.CommonPrefix) bool {
+		for _, obj := range contents {
+			if key := strings.TrimPrefix(aws.ToString(obj.Key), s3Path); key != "" {
+				listing.Keys = append(listing.Keys, key)
+			}
+		}
+		for _, prefix := range prefixes {
+			listing.CommonPrefixes = append(listing.CommonPrefixes, strings.TrimPrefix(aws.ToString(prefix.Prefix), s3Path))
 		}
 		return true
 	})
@@ -78,194 +753,1085 @@ func GetListOfFilesFromS3(iClient interface{}, path string) ([]string, error) {
 		return nil, err
 	}
 
-	return outLines, nil
+	return listing, nil
 }
 
-// DownloadFromS3 downloads a single file from S3
-func DownloadFromS3(iClient interface{}, path string, writer io.Writer, verbose bool) error {
-	s := iClient.(*session.Session)
+// S3StatOptions holds the options of getting the metadata of a single file in S3
+type S3StatOptions struct {
+	// RequesterPays acknowledges that the requests to a Requester Pays bucket are charged
+	// to the requester. Requests to such a bucket are denied without it
+	RequesterPays bool
+}
+
+// StatS3Object gets the metadata of a single file in S3 without downloading it.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func StatS3Object(ctx context.Context, iClient interface{}, path string) (*ObjectStat, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.Stat(ctx, path)
+}
+
+// StatS3ObjectWithOptions gets the metadata of a single file in S3 without downloading it, using opts.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func StatS3ObjectWithOptions(ctx context.Context, iClient interface{}, path string, opts S3StatOptions) (*ObjectStat, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.StatWithOptions(ctx, path, opts)
+}
+
+// Stat gets the metadata of a single file in S3 without downloading it.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func (c *S3Client) Stat(ctx context.Context, path string) (*ObjectStat, error) {
+	return c.StatWithOptions(ctx, path, S3StatOptions{})
+}
+
+// StatWithOptions gets the metadata of a single file in S3 without downloading it, using opts.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func (c *S3Client) StatWithOptions(ctx context.Context, path string, opts S3StatOptions) (*ObjectStat, error) {
 	pSplit := strings.Split(path, "/")
-	if err := validateS3Path(pSplit); err != nil {
-		if verbose {
-			log.Printf("validate s3 path error: %s", err)
-		}
-		return err
+	if err := validateS3Path(pSplit, true); err != nil {
+		return nil, err
 	}
-	bucket, s3Path := initS3Variables(pSplit)
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	out, err := headS3Object(ctx, c.svc, bucket, s3Path, "", requestPayer(opts.RequesterPays), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectStat{
+		Size:         aws.ToInt64(out.ContentLength),
+		ContentType:  aws.ToString(out.ContentType),
+		ETag:         strings.Trim(aws.ToString(out.ETag), `"`),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
 
-	attempts := 3
-	attempt := 0
-	for attempt < attempts {
-		attempt++
+// quoteETag returns etag within quotes, as sent in conditional requests.
+// The ETags of ObjectStat are unquoted
+func quoteETag(etag string) string {
+	if etag == "*" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
 
-		if verbose {
-			log.Printf("Attempt %d to download file from s3://%s/%s", attempt, bucket, s3Path)
+// sseCustomerKeySize is the size in bytes of the AES256 keys of SSE-C encryption
+const sseCustomerKeySize = 32
+
+// sseCustomerHeaders returns the algorithm, the base64 encoded key and the base64 encoded MD5
+// of the key sent with each request to a file encrypted with the customer provided key of SSE-C,
+// or nils without a key
+func sseCustomerHeaders(key []byte) (algorithm, encodedKey, keyMD5 *string) {
+	if len(key) == 0 {
+		return nil, nil, nil
+	}
+	sum := md5.Sum(key)
+	return aws.String(string(types.ServerSideEncryptionAes256)), aws.String(base64.StdEncoding.EncodeToString(key)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// validateSSECustomerKey checks that key, if set, is a key of SSE-C encryption
+func validateSSECustomerKey(key []byte) error {
+	if len(key) != 0 && len(key) != sseCustomerKeySize {
+		return fmt.Errorf("an SSE-C key must be %d bytes long, got %d", sseCustomerKeySize, len(key))
+	}
+	return nil
+}
+
+// requestPayer returns the RequestPayer of the requests to a Requester Pays bucket if requesterPays is set
+func requestPayer(requesterPays bool) types.RequestPayer {
+	if !requesterPays {
+		return ""
+	}
+	return types.RequestPayerRequester
+}
+
+// headS3Object gets the metadata of key, or of its version versionID if set, encrypted with
+// the SSE-C key sseKey if set. It returns an error wrapping ErrNotFound if the object does not exist
+func headS3Object(ctx context.Context, svc S3API, bucket, key, versionID string, payer types.RequestPayer, sseKey []byte) (*s3.HeadObjectOutput, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		RequestPayer: payer,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomerHeaders(sseKey)
+	if versionID != "" {
+		input.VersionId = aws.String(versionID)
+	}
+
+	out, err := svc.HeadObject(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("s3://%s/%s: %w", bucket, key, ErrNotFound)
 		}
+		return nil, err
+	}
 
-		downloader := s3manager.NewDownloader(s)
-		downloader.Concurrency = 1 // support writerWrapper
+	return out, nil
+}
 
-		_, err := downloader.Download(writerWrapper{writer},
-			&s3.GetObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    aws.String(s3Path),
-			})
+// DownloadFromS3 downloads a single file from S3
+func DownloadFromS3(ctx context.Context, iClient interface{}, path string, writer io.Writer, verbose bool) error {
+	_, err := DownloadFromS3WithOptions(ctx, iClient, path, writer, S3DownloadOptions{Verbose: verbose})
+	return err
+}
+
+// DownloadFromS3WithOptions downloads a single file from S3 using opts.
+// It returns an error wrapping ErrObjectArchived if the file is archived and not restored,
+// or ErrNotFound if it does not exist, explaining when path is a prefix of other files instead
+func DownloadFromS3WithOptions(ctx context.Context, iClient interface{}, path string, writer io.Writer, opts S3DownloadOptions) (TransferResult, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	return c.Download(ctx, path, writer, opts)
+}
+
+// Download downloads a single file from S3 using opts.
+// It returns an error wrapping ErrObjectArchived if the file is archived and not restored,
+// or ErrNotFound if it does not exist, explaining when path is a prefix of other files instead
+func (c *S3Client) Download(ctx context.Context, path string, writer io.Writer, opts S3DownloadOptions) (TransferResult, error) {
+	opCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	result, err := c.download(opCtx, path, writer, opts)
+	if errors.Is(err, ErrNotFound) && opts.VersionID == "" {
+		bucket, key := initS3ObjectVariables(strings.Split(path, "/"))
+		err = c.prefixNotFoundError(opCtx, bucket, key, opts.RequesterPays, err)
+	}
+	return result, timeoutError(ctx, opCtx, opts.Timeout, err)
+}
+
+// prefixNotFoundError returns err, the error of a download of a key that does not exist,
+// explaining that key is a prefix if other files are under it, as a directory would be
+func (c *S3Client) prefixNotFoundError(ctx context.Context, bucket, key string, requesterPays bool, err error) error {
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	isPrefix := false
+	listErr := listS3Pages(ctx, c.svc, bucket, prefix, "", S3ListOptions{Limit: 1, RequesterPays: requesterPays}, func(contents []types.Object, _ []types.CommonPrefix) bool {
+		isPrefix = len(contents) != 0
+		return false
+	})
+	if listErr != nil || !isPrefix {
+		return err
+	}
+	return fmt.Errorf("s3://%s/%s is not a file but a prefix of other files, list it or use DownloadPrefixToDir to download them: %w", bucket, key, err)
+}
 
-		if verbose {
-			log.Printf("Downloaded file from s3://%s/%s", bucket, s3Path)
+// download is Download, within the timeout of the operation
+func (c *S3Client) download(ctx context.Context, path string, writer io.Writer, opts S3DownloadOptions) (TransferResult, error) {
+	var result TransferResult
+	start := time.Now()
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		logger.Errorf("validate s3 path error: %s", err)
+		return result, err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	// The downloader writes parts concurrently at their offsets. A plain
+	// io.Writer can only be written in order, one part at a time
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = manager.DefaultDownloadConcurrency
+	}
+	sink, ok := writer.(io.WriterAt)
+	if !ok {
+		ww := newWriterWrapper(writer)
+		if !ww.seekable() {
+			concurrency = 1
+		}
+		sink = ww
+	}
+
+	if limiter := newBandwidthLimiter(opts.MaxBytesPerSecond); limiter != nil {
+		sink = &throttledWriterAt{ctx: ctx, w: sink, limiter: limiter}
+	}
+	counter := &countingWriterAt{w: sink, total: -1, progress: opts.Progress}
+	var target io.WriterAt = counter
+	var verifier *objectVerifier
+	var head *s3.HeadObjectOutput
+	if err := validateSSECustomerKey(opts.SSECustomerKey); err != nil {
+		return result, err
+	}
+	if opts.ChecksumAlgorithm != "" {
+		if _, ok := s3Checksums[opts.ChecksumAlgorithm]; !ok {
+			return result, fmt.Errorf("unsupported checksum algorithm %q", opts.ChecksumAlgorithm)
 		}
+		opts.VerifyChecksum = true
+	}
+	decompress := false
+	if opts.Progress != nil || opts.VerifyChecksum || opts.Decompress {
+		var err error
+		head, err = headS3Object(ctx, c.svc, bucket, s3Path, opts.VersionID, requestPayer(opts.RequesterPays), opts.SSECustomerKey)
 		if err != nil {
-			if verbose {
-				log.Printf("Error: %v", err)
-				log.Printf("Attempt: %v", attempt)
+			return result, err
+		}
+		counter.total = aws.ToInt64(head.ContentLength)
+		if opts.Decompress && isGzipEncoded(aws.ToString(head.ContentEncoding)) {
+			if opts.VerifyChecksum {
+				return result, fmt.Errorf("cannot verify the checksum of s3://%s/%s while decompressing it", bucket, s3Path)
+			}
+			// The size of the decompressed content is unknown
+			decompress, counter.total = true, -1
+		}
+		if opts.VerifyChecksum {
+			verifier, err = newObjectVerifier(ctx, c.svc, bucket, s3Path, opts.VersionID, opts.ChecksumAlgorithm, requestPayer(opts.RequesterPays), opts.SSECustomerKey, head, counter, logger)
+			if err != nil {
+				return result, err
 			}
-			if attempt == attempts {
-				if verbose {
-					log.Printf("This was last attempt")
+			if verifier != nil {
+				target = verifier
+				if src, ok := writer.(io.ReaderAt); ok {
+					verifier.readBack(src, aws.ToInt64(head.ContentLength))
+				} else {
+					// Parts written in order are hashed as they come, without holding any
+					concurrency = 1
 				}
-				return err
 			}
-			utils.Sleep(attempt)
-			continue
 		}
-		return nil
 	}
 
-	return nil
+	desc := fmt.Sprintf("download file from s3://%s/%s", bucket, s3Path)
+	metrics := resolveMetrics(opts.Metrics)
+	ctx, span := startSpan(ctx, "skbn.DownloadFromS3", bucket, s3Path)
+	notModified, archived := false, false
+	err := opts.Retry.doWithMetrics(ctx, logger, metrics, "download", desc, func() error {
+		result.Attempts++
+		counter.reset()
+		if verifier != nil {
+			verifier.reset()
+		}
+		downloader := manager.NewDownloader(c.svc, func(d *manager.Downloader) {
+			d.Concurrency = concurrency
+		})
+
+		input := &s3.GetObjectInput{
+			Bucket:       aws.String(bucket),
+			Key:          aws.String(s3Path),
+			RequestPayer: requestPayer(opts.RequesterPays),
+		}
+		if opts.VersionID != "" {
+			input.VersionId = aws.String(opts.VersionID)
+		}
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomerHeaders(opts.SSECustomerKey)
+		if verifier != nil {
+			// Fail instead of mixing the parts of two versions if the file changes meanwhile
+			input.IfMatch = head.ETag
+		}
+		if opts.IfNoneMatch != "" {
+			input.IfNoneMatch = aws.String(quoteETag(opts.IfNoneMatch))
+		}
+		if !opts.IfModifiedSince.IsZero() {
+			input.IfModifiedSince = aws.Time(opts.IfModifiedSince)
+		}
+
+		var n int64
+		var err error
+		if decompress {
+			input.IfMatch = head.ETag
+			n, err = c.downloadDecompressed(ctx, input, target)
+		} else {
+			n, err = downloader.Download(ctx, target, input)
+		}
+		result.BytesTransferred = n
+		if isS3NotModified(err) {
+			// Not a failure worth another attempt, the first part is not written on a 304
+			notModified = true
+			return nil
+		}
+		if isS3ObjectArchived(err) {
+			archived = true
+			return nil
+		}
+		return err
+	})
+	if notModified {
+		err = fmt.Errorf("s3://%s/%s: %w", bucket, s3Path, ErrNotModified)
+	}
+	if archived {
+		err = fmt.Errorf("s3://%s/%s must be restored to be downloaded: %w", bucket, s3Path, ErrObjectArchived)
+	}
+	result.Duration = time.Since(start)
+	if err == nil && verifier != nil {
+		if vErr := verifier.verify(); vErr != nil {
+			err = fmt.Errorf("could not verify s3://%s/%s: %w", bucket, s3Path, vErr)
+		}
+	}
+	observe(metrics, "download", result.BytesTransferred, result.Duration, err)
+	endSpan(span, result.BytesTransferred, result.Attempts, err)
+	if err != nil {
+		return result, err
+	}
+
+	logger.Infof("Downloaded file from s3://%s/%s (%d bytes in %s)", bucket, s3Path, result.BytesTransferred, result.Duration)
+	return result, nil
 }
 
+// writerWrapper lets an io.Writer be used as the io.WriterAt of a downloader.
+// An io.WriteSeeker is written at the requested offsets. Any other writer can
+// only be appended to, so writes must come in order (a downloader concurrency of 1)
+// and a write at any other offset fails instead of corrupting the output
 type writerWrapper struct {
-	w io.Writer
+	w      io.Writer
+	mu     sync.Mutex
+	offset int64 // next offset of an append only writer
+}
+
+func newWriterWrapper(w io.Writer) *writerWrapper {
+	return &writerWrapper{w: w}
 }
 
-func (ww writerWrapper) WriteAt(p []byte, off int64) (n int, err error) {
-	return ww.w.Write(p)
+func (ww *writerWrapper) seekable() bool {
+	_, ok := ww.w.(io.WriteSeeker)
+	return ok
+}
+
+func (ww *writerWrapper) WriteAt(p []byte, off int64) (int, error) {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	if ws, ok := ww.w.(io.WriteSeeker); ok {
+		if _, err := ws.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return ws.Write(p)
+	}
+
+	if off != ww.offset {
+		return 0, fmt.Errorf("cannot write at offset %d to a writer that is not seekable, next offset is %d", off, ww.offset)
+	}
+	n, err := ww.w.Write(p)
+	ww.offset += int64(n)
+	return n, err
 }
 
 // UploadToS3 uploads a single file to S3
-func UploadToS3(iClient interface{}, toPath, fromPath string, reader io.Reader, s3partSize int64, s3maxUploadParts int, verbose bool) error {
-	s := iClient.(*session.Session)
+func UploadToS3(ctx context.Context, iClient interface{}, toPath, fromPath string, reader io.Reader, s3partSize int64, s3maxUploadParts int, verbose bool) error {
+	_, err := UploadToS3WithOptions(ctx, iClient, toPath, fromPath, reader, S3UploadOptions{
+		PartSize:       s3partSize,
+		MaxUploadParts: s3maxUploadParts,
+		Verbose:        verbose,
+	})
+	return err
+}
+
+// UploadToS3WithOptions uploads a single file to S3 using opts. It is S3Client.Upload on iClient
+func UploadToS3WithOptions(ctx context.Context, iClient interface{}, toPath, fromPath string, reader io.Reader, opts S3UploadOptions) (UploadResult, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	return c.Upload(ctx, toPath, fromPath, reader, opts)
+}
+
+// Upload uploads a single file to S3 using opts.
+// A toPath of a bucket only uploads to the file name of fromPath, and fails if it has none,
+// such as a stream from stdin.
+// The reader does not need to be seekable or of a known length: content of a known size up
+// to opts.MultipartThreshold, or that fits in a single part, is sent with one request, anything
+// larger is buffered one part at a time by the multipart uploader. A stream can therefore hold at most
+// opts.PartSize * opts.MaxUploadParts bytes, and buffers up to
+// opts.PartSize * (opts.Concurrency + 1) bytes in memory, the concurrency defaulting to 5.
+// Peak memory therefore grows with both the part size and the number of concurrent uploads,
+// see opts.BufferProvider to share the buffers of seekable readers across uploads.
+// A seekable reader, such as an *os.File or a *bytes.Reader, is measured to send its
+// Content-Length, which some S3 compatible endpoints require, and rewound before a retry.
+// Other readers cannot be read again, so their upload is attempted once, whatever opts.Retry
+func (c *S3Client) Upload(ctx context.Context, toPath, fromPath string, reader io.Reader, opts S3UploadOptions) (UploadResult, error) {
+	opCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	result, err := c.upload(opCtx, toPath, fromPath, reader, opts)
+	return result, timeoutError(ctx, opCtx, opts.Timeout, err)
+}
+
+// upload is Upload, within the timeout of the operation
+func (c *S3Client) upload(ctx context.Context, toPath, fromPath string, reader io.Reader, opts S3UploadOptions) (UploadResult, error) {
+	var result UploadResult
+	start := time.Now()
+	logger := resolveLogger(opts.Logger, opts.Verbose)
 	pSplit := strings.Split(toPath, "/")
-	if err := validateS3Path(pSplit); err != nil {
-		if verbose {
-			log.Printf("validate s3 path error: %s", err)
-		}
-		return err
+	if err := validateS3Path(pSplit, false); err != nil {
+		logger.Errorf("validate s3 path error: %s", err)
+		return result, err
+	}
+	if len(pSplit) == 2 && pSplit[1] == "" {
+		// bucket/ is a bucket only, not an empty key
+		pSplit = pSplit[:1]
 	}
 	if len(pSplit) == 1 {
-		_, fileName := filepath.Split(fromPath)
+		fileName, ok := uploadFileName(fromPath)
+		if !ok {
+			return result, fmt.Errorf("s3://%s has no key and %q has no file name to use as one, a key is required to upload a stream", pSplit[0], fromPath)
+		}
 		pSplit = append(pSplit, fileName)
 	}
-	bucket, s3Path := initS3Variables(pSplit)
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+	result.Key = s3Path
+	if err := opts.validate(); err != nil {
+		return result, err
+	}
+	if opts.usesObjectLock() && opts.ChecksumAlgorithm == "" {
+		// S3 rejects uploads with Object Lock without a checksum
+		opts.ChecksumAlgorithm = string(types.ChecksumAlgorithmCrc32)
+	}
 
-	attempts := 3
-	attempt := 0
-	for attempt < attempts {
-		attempt++
+	offset, length, seekable := seekableLength(reader)
+	if seekable {
+		opts.Size = length
+	} else {
+		// Another attempt would upload the rest of a stream partly read by the failed one
+		// as if it were the whole file
+		opts.Retry.MaxAttempts = 1
+	}
 
-		if verbose {
-			log.Printf("Attempt %d to upload file to s3://%s/%s", attempt, bucket, s3Path)
+	contentType, body := opts.ContentType, reader
+	if contentType == "" && !opts.DisableContentTypeDetection {
+		// Read the first 512 bytes to detect the content type, and put them back
+		// in front of the rest of the stream so the object is uploaded intact
+		sniff := make([]byte, 512)
+		n, err := io.ReadFull(reader, sniff)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			logger.Errorf("read content error: %s", err)
+			return result, err
 		}
+		contentType = http.DetectContentType(sniff[:n])
+		if seekable {
+			if _, err := reader.(io.Seeker).Seek(offset, io.SeekStart); err != nil {
+				return result, fmt.Errorf("could not rewind the content of s3://%s/%s: %w", bucket, s3Path, err)
+			}
+		} else {
+			body = io.MultiReader(bytes.NewReader(sniff[:n]), reader)
+		}
+	}
 
-		// uploader := s3manager.NewUploader(s)
-		uploader := s3manager.NewUploader(s, func(u *s3manager.Uploader) {
-			u.PartSize = s3partSize
-			u.MaxUploadParts = s3maxUploadParts
-		})
+	partSize, maxUploadParts := opts.partSizing()
+	if err := opts.checkPartSizing(partSize, maxUploadParts); err != nil {
+		return result, err
+	}
+	if opts.Size <= 0 {
+		logger.Infof("Size of s3://%s/%s is unknown, it will fail if larger than %s (part size %s x %d parts)",
+			bucket, s3Path, formatBytes(partSize*int64(maxUploadParts)), formatBytes(partSize), maxUploadParts)
+	}
+	if opts.DryRun {
+		logger.Infof("Dry run: would upload file to s3://%s/%s", bucket, s3Path)
+		return result, nil
+	}
+	desc := fmt.Sprintf("upload file to s3://%s/%s", bucket, s3Path)
+	if opts.OnlyIfAbsent && opts.CheckAbsentWithHead {
+		_, err := headS3Object(ctx, c.svc, bucket, s3Path, "", "", opts.SSECustomerKey)
+		if err == nil {
+			return result, fmt.Errorf("s3://%s/%s already exists: %w", bucket, s3Path, ErrPreconditionFailed)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return result, err
+		}
+	}
+	total := opts.Size
+	if total <= 0 {
+		total = -1
+	}
+	limiter := newBandwidthLimiter(opts.MaxBytesPerSecond)
+	if limiter != nil {
+		body = &throttledReader{ctx: ctx, r: body, limiter: limiter}
+	}
+	counter := &countingReader{r: body, total: total, progress: opts.Progress}
+	var section *countingReaderAt
+	if ra, ok := reader.(io.ReaderAt); ok && seekable && !opts.Compress && limiter == nil {
+		// The uploader only reads the parts of a body keeping ReadAt and Seek in place,
+		// through opts.BufferProvider, instead of copying each to a buffer of its own
+		section = &countingReaderAt{SectionReader: io.NewSectionReader(ra, offset, length), total: total, progress: opts.Progress}
+	}
+	var clientOptions []func(*s3.Options)
+	if opts.OnlyIfAbsent && !opts.CheckAbsentWithHead {
+		clientOptions = append(clientOptions, ifNoneMatch)
+	}
+	if len(opts.Headers) != 0 {
+		clientOptions = append(clientOptions, headersOption(opts.Headers))
+	}
+	metrics := resolveMetrics(opts.Metrics)
+	ctx, span := startSpan(ctx, "skbn.UploadToS3", bucket, s3Path)
+	err := opts.Retry.doWithMetrics(ctx, logger, metrics, "upload", desc, func() error {
+		result.Attempts++
+		if seekable && result.Attempts > 1 {
+			if _, err := reader.(io.Seeker).Seek(offset, io.SeekStart); err != nil {
+				return fmt.Errorf("could not rewind the content of s3://%s/%s: %w", bucket, s3Path, err)
+			}
+		}
+		counter.n = 0
+		var content io.Reader = counter
+		if section != nil {
+			if err := section.reset(); err != nil {
+				return fmt.Errorf("could not rewind the content of s3://%s/%s: %w", bucket, s3Path, err)
+			}
+			content = section
+		}
+		if opts.Compress {
+			gz := newGzipReader(counter)
+			defer gz.Close()
+			content = gz
+		}
+		input := &s3.PutObjectInput{
+			Bucket:             aws.String(bucket),
+			Key:                aws.String(s3Path),
+			Body:               content,
+			ContentDisposition: aws.String("attachment"),
+		}
+		if seekable && !opts.Compress {
+			input.ContentLength = aws.Int64(length)
+		}
+		if contentType != "" {
+			input.ContentType = aws.String(contentType)
+		}
+		opts.apply(input)
 
-		// Lee una porción del contenido del reader en un buffer
-		var buf []byte = make([]byte, 512) // 512 bytes es suficiente para determinar el tipo MIME
-		var n int
-		n, err = reader.Read(buf)
-		
-		if err != nil && err != io.EOF {
-			fmt.Println("Error al leer el contenido:", err)
+		var out *manager.UploadOutput
+		var err error
+		if opts.singlePart() {
+			out, err = c.putObject(ctx, input, clientOptions...)
+		} else {
+			uploader := manager.NewUploader(c.svc, func(u *manager.Uploader) {
+				u.PartSize = partSize
+				u.MaxUploadParts = int32(maxUploadParts)
+				if opts.Concurrency > 0 {
+					u.Concurrency = opts.Concurrency
+				}
+				u.LeavePartsOnError = opts.LeavePartsOnError
+				if opts.BufferProvider != nil {
+					u.BufferProvider = opts.BufferProvider
+				}
+				u.ClientOptions = clientOptions
+			})
+			out, err = uploader.Upload(ctx, input)
+		}
+		if err != nil {
+			var mErr manager.MultiUploadFailure
+			if errors.As(err, &mErr) && opts.LeavePartsOnError {
+				logger.Infof("Left parts of multipart upload %s to s3://%s/%s", mErr.UploadID(), bucket, s3Path)
+			}
+			if opts.OnlyIfAbsent && isS3PreconditionFailed(err) {
+				return fmt.Errorf("s3://%s/%s already exists: %w", bucket, s3Path, ErrPreconditionFailed)
+			}
 			return err
 		}
+		result.ETag = strings.Trim(aws.ToString(out.ETag), `"`)
+		result.VersionID = aws.ToString(out.VersionID)
+		result.Location = out.Location
+		return nil
+	})
+	result.BytesTransferred = counter.n
+	if section != nil {
+		result.BytesTransferred = section.bytesRead()
+	}
+	result.Duration = time.Since(start)
+	observe(metrics, "upload", result.BytesTransferred, result.Duration, err)
+	endSpan(span, result.BytesTransferred, result.Attempts, err)
+	if err != nil {
+		return result, err
+	}
+
+	logger.Infof("Uploaded file to s3://%s/%s (%d bytes in %s)", bucket, s3Path, result.BytesTransferred, result.Duration)
+	return result, nil
+}
+
+// DeleteFromS3 deletes a single file from S3
+func DeleteFromS3(ctx context.Context, iClient interface{}, path string, verbose bool) error {
+	return DeleteFromS3WithOptions(ctx, iClient, path, S3DeleteOptions{Verbose: verbose})
+}
+
+// DeleteFromS3WithOptions deletes a single file from S3 using opts.
+// A file that does not exist is considered deleted, unless opts.ErrorIfNotFound is set
+func DeleteFromS3WithOptions(ctx context.Context, iClient interface{}, path string, opts S3DeleteOptions) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, path, opts)
+}
 
-		_, err = uploader.Upload(&s3manager.UploadInput{
+// Delete deletes a single file from S3 using opts.
+// A file that does not exist is considered deleted, unless opts.ErrorIfNotFound is set
+func (c *S3Client) Delete(ctx context.Context, path string, opts S3DeleteOptions) error {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		logger.Errorf("validate s3 path error: %s", err)
+		return err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	// DeleteObject succeeds for missing keys, so check existence up front
+	if opts.ErrorIfNotFound {
+		if _, err := c.Stat(ctx, path); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		logger.Infof("Dry run: would delete file from s3://%s/%s", bucket, s3Path)
+		return nil
+	}
+	desc := fmt.Sprintf("delete file from s3://%s/%s", bucket, s3Path)
+	var notFound bool
+	err := opts.Retry.do(ctx, logger, desc, func() error {
+		_, err := c.svc.DeleteObject(ctx, &s3.DeleteObjectInput{
 			Bucket: aws.String(bucket),
 			Key:    aws.String(s3Path),
-			Body:   reader,
-			ContentDisposition: aws.String("attachment"),
-			// ContentLength:      aws.Int64(int64(len(buffer))),
-			ContentType:        aws.String(http.DetectContentType(buf[:n])),
 		})
+		if err != nil && isS3NotFound(err) {
+			notFound = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if notFound && opts.ErrorIfNotFound {
+		return fmt.Errorf("s3://%s/%s: %w", bucket, s3Path, ErrNotFound)
+	}
+
+	logger.Infof("Deleted file from s3://%s/%s", bucket, s3Path)
+	return nil
+}
+
+// DeletePrefixFromS3 deletes all files in path from S3 (recursive) and returns the number of deleted files
+func DeletePrefixFromS3(ctx context.Context, iClient interface{}, path string, verbose bool) (int, error) {
+	return DeletePrefixFromS3WithOptions(ctx, iClient, path, S3DeleteOptions{Verbose: verbose})
+}
+
+// DeletePrefixFromS3WithOptions deletes all files in path from S3 (recursive) using opts
+// and returns the number of deleted files. Files are deleted in batches of up to 1000,
+// and the files that could not be deleted are listed in the returned error
+func DeletePrefixFromS3WithOptions(ctx context.Context, iClient interface{}, path string, opts S3DeleteOptions) (int, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return 0, err
+	}
+	return c.DeletePrefix(ctx, path, opts)
+}
+
+// DeletePrefix deletes all files in path from S3 (recursive) using opts
+// and returns the number of deleted files. Files are deleted in batches of up to 1000,
+// and the files that could not be deleted are listed in the returned error
+func (c *S3Client) DeletePrefix(ctx context.Context, path string, opts S3DeleteOptions) (int, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return 0, err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+	logger := resolveLogger(opts.Logger, opts.Verbose)
 
-		if verbose {
-			log.Printf("Uploaded file to s3://%s/%s", bucket, s3Path)
+	deleted := 0
+	var failed []string
+	var batch []types.ObjectIdentifier
+	var batchErr error
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
 		}
-		if err != nil {
-			if verbose {
-				log.Printf("Error: %v", err)
-				log.Printf("Attempt: %v", attempt)
+		if opts.DryRun {
+			for _, obj := range batch {
+				logger.Infof("Dry run: would delete file from s3://%s/%s", bucket, aws.ToString(obj.Key))
 			}
-			if attempt == attempts {
-				if verbose {
-					log.Printf("This was last attempt")
-				}
-				return err
-			}
-			utils.Sleep(attempt)
-			continue
+			deleted += len(batch)
+			batch = nil
+			return
 		}
-		return nil
+		n, f, err := deleteS3Batch(ctx, c.svc, bucket, batch, opts.Retry, logger)
+		deleted += n
+		failed = append(failed, f...)
+		batchErr = err
+		batch = nil
 	}
 
-	return nil
+	err := listS3Objects(ctx, c.svc, bucket, s3Path, S3ListOptions{}, func(obj types.Object) bool {
+		if _, ok := relativeS3Key(aws.ToString(obj.Key), s3Path); !ok {
+			return true
+		}
+		batch = append(batch, types.ObjectIdentifier{Key: obj.Key})
+		if len(batch) == s3MaxDeleteObjects {
+			flush()
+		}
+		return batchErr == nil
+	})
+	if err == nil && batchErr == nil {
+		flush()
+	}
+	if err == nil {
+		err = batchErr
+	}
+	if err != nil {
+		return deleted, err
+	}
+	if len(failed) != 0 {
+		return deleted, fmt.Errorf("could not delete %d files from s3://%s: %s", len(failed), bucket, strings.Join(failed, ", "))
+	}
+
+	return deleted, nil
 }
 
-// calculatePartSize calculates an appropriate part size for the multipart upload
-func calculatePartSize(fileSize int64) int64 {
-	const maxParts = 10000
-	partSize := fileSize / maxParts
-	if partSize < 5*1024*1024 {
-		partSize = 5 * 1024 * 1024 // Minimum part size of 5 MB
+// s3MaxDeleteObjects is the maximum number of keys in a single DeleteObjects request
+const s3MaxDeleteObjects = 1000
+
+// deleteS3Batch deletes up to s3MaxDeleteObjects objects in a single request, retrying it per retry.
+// It returns the number of deleted objects and a description of each object that could not be deleted
+func deleteS3Batch(ctx context.Context, svc S3API, bucket string, batch []types.ObjectIdentifier, retry RetryConfig, logger Logger) (int, []string, error) {
+	var out *s3.DeleteObjectsOutput
+	desc := fmt.Sprintf("delete %d files from s3://%s", len(batch), bucket)
+	err := retry.do(ctx, logger, desc, func() error {
+		var err error
+		out, err = svc.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{
+				Objects: batch,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var failed []string
+	for _, e := range out.Errors {
+		failed = append(failed, fmt.Sprintf("%s (%s: %s)", aws.ToString(e.Key), aws.ToString(e.Code), aws.ToString(e.Message)))
+	}
+	logger.Infof("Deleted %d files from s3://%s", len(batch)-len(failed), bucket)
+
+	return len(batch) - len(failed), failed, nil
+}
+
+// calculatePartSize calculates a part size for the multipart upload that fits fileSize in maxParts parts
+func calculatePartSize(fileSize int64, maxParts int) int64 {
+	partSize := (fileSize + int64(maxParts) - 1) / int64(maxParts)
+	if partSize < s3MinPartSize {
+		partSize = s3MinPartSize
 	}
 	return partSize
 }
 
-func getNewSession() (*session.Session, error) {
+// getNewClient returns a client to S3 using config, without checking the connection.
+// The region of the client and where it comes from are logged to logger
+func getNewClient(ctx context.Context, cfg S3Config, logger Logger) (*s3.Client, error) {
+	disableSSL := boolOrEnv(cfg.DisableSSL, "AWS_S3_NO_SSL")
+	endpoint := resolveEndpoint(cfg)
+	if endpoint != "" && !strings.Contains(endpoint, "://") {
+		// Endpoints used to be given without a scheme
+		if disableSSL {
+			endpoint = "http://" + endpoint
+		} else {
+			endpoint = "https://" + endpoint
+		}
+	}
+
+	var loadOptions []func(*config.LoadOptions) error
+	regionSource := "the shared config profile"
+	if cfg.Region != "" {
+		regionSource = "the configuration"
+	} else if os.Getenv("AWS_REGION") != "" {
+		regionSource = "AWS_REGION"
+	} else if os.Getenv("AWS_DEFAULT_REGION") != "" {
+		regionSource = "AWS_DEFAULT_REGION"
+	}
+	if rg := stringOrEnv(cfg.Region, "AWS_REGION"); rg != "" {
+		loadOptions = append(loadOptions, config.WithRegion(rg))
+	}
+	if profile := stringOrEnv(cfg.Profile, "AWS_PROFILE"); profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(profile))
+	}
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if httpClient != nil {
+		loadOptions = append(loadOptions, config.WithHTTPClient(httpClient))
+	}
+	if boolOrEnv(cfg.DisableEC2Metadata, "AWS_EC2_METADATA_DISABLED") {
+		loadOptions = append(loadOptions, config.WithEC2IMDSClientEnableState(imds.ClientDisabled))
+	} else {
+		loadOptions = append(loadOptions, config.WithEC2RoleCredentialOptions(func(o *ec2rolecreds.Options) {
+			o.Client = newIMDSClient(ec2MetadataTimeout(cfg))
+		}))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, err
+	}
+	// The region of the shared config profile applies when AWS_REGION and AWS_DEFAULT_REGION
+	// are not set. S3 compatible stores ignore the region, but requests are signed with one
+	if awsConfig.Region == "" {
+		awsConfig.Region = resolveDefaultRegion(cfg)
+		regionSource = "the default region"
+	}
+	logger.Infof("Using region %s from %s", awsConfig.Region, regionSource)
+
+	if roleARN := stringOrEnv(cfg.AssumeRoleARN, "AWS_ASSUME_ROLE_ARN"); roleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsConfig), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			if externalID := stringOrEnv(cfg.AssumeRoleExternalID, "AWS_ASSUME_ROLE_EXTERNAL_ID"); externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+			if sessionName := stringOrEnv(cfg.AssumeRoleSessionName, "AWS_ASSUME_ROLE_SESSION_NAME"); sessionName != "" {
+				o.RoleSessionName = sessionName
+			}
+		})
+		awsConfig.Credentials = aws.NewCredentialsCache(provider)
+	}
+
+	return s3.NewFromConfig(awsConfig, mapErrors, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			// Stores such as older MinIO reject the CRC32 checksums the SDK sends by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		o.EndpointOptions.DisableHTTPS = disableSSL
+		// Ranged downloads of files without a checksum would log a line per part
+		o.DisableLogOutputChecksumValidationSkipped = true
+		o.UsePathStyle = boolOrEnv(cfg.ForcePathStyle, "AWS_S3_FORCE_PATH_STYLE") ||
+			(endpoint != "" && !boolOrEnv(cfg.VirtualHostedStyle, "AWS_S3_VIRTUAL_HOSTED_STYLE"))
+		o.UseAccelerate = boolOrEnv(cfg.UseAccelerate, "AWS_S3_USE_ACCELERATE")
+		if boolOrEnv(cfg.UseDualStack, "AWS_S3_USE_DUALSTACK") {
+			o.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+		}
+	}), nil
+}
+
+// newHTTPClient returns the HTTP client of cfg, or nil to use the default client of the SDK
+func newHTTPClient(cfg S3Config) (aws.HTTPClient, error) {
+	tuned := cfg.TLSConfig != nil || cfg.CABundlePath != "" || len(cfg.CACertPEM) > 0 ||
+		cfg.ProxyURL != "" || cfg.MaxIdleConns != 0 ||
+		cfg.MaxIdleConnsPerHost != 0 || cfg.MaxConnsPerHost != 0
+	if cfg.HTTPClient != nil {
+		if tuned {
+			return nil, fmt.Errorf("the transport options cannot be combined with a custom HTTP client, configure its transport instead")
+		}
+		return cfg.HTTPClient, nil
+	}
+	if !tuned {
+		return nil, nil
+	}
 
-	awsConfig := &aws.Config{}
+	tlsConfig, err := customCATLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var proxy func(*http.Request) (*url.URL, error)
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", cfg.ProxyURL, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		if tlsConfig != nil {
+			tr.TLSClientConfig = tlsConfig
+		}
+		if proxy != nil {
+			tr.Proxy = proxy
+		}
+		if cfg.MaxIdleConns != 0 {
+			tr.MaxIdleConns = cfg.MaxIdleConns
+		}
+		if cfg.MaxIdleConnsPerHost != 0 {
+			tr.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		}
+		tr.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}), nil
+}
 
-	region := "eu-central-1"
+// customCATLSConfig returns a copy of the TLS configuration of cfg trusting the CAs of
+// cfg.CABundlePath and cfg.CACertPEM, or nil if none is set
+func customCATLSConfig(cfg S3Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSConfig != nil {
+		tlsConfig = cfg.TLSConfig.Clone()
+	}
+	if cfg.CABundlePath == "" && len(cfg.CACertPEM) == 0 {
+		if cfg.TLSConfig == nil {
+			return nil, nil
+		}
+		return tlsConfig, nil
+	}
 
-	if rg := os.Getenv("AWS_REGION"); rg != "" {
-		region = rg
+	pemCerts := cfg.CACertPEM
+	if cfg.CABundlePath != "" {
+		bundle, err := os.ReadFile(cfg.CABundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the CA bundle: %w", err)
+		}
+		pemCerts = append(bundle, append([]byte("\n"), pemCerts...)...)
 	}
 
-	awsConfig.Region = aws.String(region)
+	if tlsConfig.RootCAs != nil {
+		tlsConfig.RootCAs = tlsConfig.RootCAs.Clone()
+	} else if roots, err := x509.SystemCertPool(); err == nil {
+		tlsConfig.RootCAs = roots
+	} else {
+		tlsConfig.RootCAs = x509.NewCertPool()
+	}
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(pemCerts) {
+		return nil, fmt.Errorf("no PEM encoded certificate found in the CA bundle")
+	}
+	return tlsConfig, nil
+}
 
-	if endpoint := os.Getenv("AWS_S3_ENDPOINT"); endpoint != "" {
-		awsConfig.Endpoint = aws.String(endpoint)
+// newIMDSClient returns a client to the EC2 instance metadata service whose requests time out
+// after timeout, configured like the one of the SDK from AWS_EC2_METADATA_SERVICE_ENDPOINT
+// and AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE
+func newIMDSClient(timeout time.Duration) *imds.Client {
+	options := imds.Options{
+		HTTPClient: awshttp.NewBuildableClient().WithTimeout(timeout),
+		// The SDK makes 3 attempts of each request, backing off up to 1 second in between
+		Retryer:                  retry.AddWithMaxBackoffDelay(retry.AddWithMaxAttempts(retry.NewStandard(), 2), 100*time.Millisecond),
+		DisableDefaultMaxBackoff: true,
+		Endpoint:                 os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"),
 	}
+	options.EndpointMode.SetFromString(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT_MODE"))
+	return imds.New(options)
+}
 
-	if disSSL := os.Getenv("AWS_S3_NO_SSL"); disSSL != "" {
-		disableSSL, _ := strconv.ParseBool(disSSL)
-		awsConfig.DisableSSL = aws.Bool(disableSSL)
+// resolveDefaultRegion returns the region used when none is set, DefaultRegion or
+// AWS_S3_DEFAULT_REGION, else us-east-1. Connecting to a bucket of another region
+// switches the client to the region of the bucket
+func resolveDefaultRegion(cfg S3Config) string {
+	if region := stringOrEnv(cfg.DefaultRegion, "AWS_S3_DEFAULT_REGION"); region != "" {
+		return region
 	}
+	return "us-east-1"
+}
 
-	if fps := os.Getenv("AWS_S3_FORCE_PATH_STYLE"); fps != "" {
-		forcePathStyle, _ := strconv.ParseBool(fps)
-		awsConfig.S3ForcePathStyle = aws.Bool(forcePathStyle)
+// ec2MetadataTimeout returns the timeout of the requests to the EC2 instance metadata service of cfg
+func ec2MetadataTimeout(cfg S3Config) time.Duration {
+	if cfg.EC2MetadataTimeout > 0 {
+		return cfg.EC2MetadataTimeout
 	}
+	if seconds, err := strconv.ParseFloat(os.Getenv("AWS_METADATA_SERVICE_TIMEOUT"), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return time.Second
+}
 
-	s, err := session.NewSession(awsConfig)
+// resolveEndpoint returns the custom endpoint of cfg, in order of precedence the one set in cfg,
+// AWS_S3_ENDPOINT, AWS_ENDPOINT_URL_S3 and AWS_ENDPOINT_URL, or "" for the AWS endpoints.
+// The standard variables are not used when AWS_IGNORE_CONFIGURED_ENDPOINT_URLS is set, like in the SDK
+func resolveEndpoint(cfg S3Config) string {
+	if endpoint := stringOrEnv(cfg.Endpoint, "AWS_S3_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if boolOrEnv(false, "AWS_IGNORE_CONFIGURED_ENDPOINT_URLS") {
+		return ""
+	}
+	return stringOrEnv(os.Getenv("AWS_ENDPOINT_URL_S3"), "AWS_ENDPOINT_URL")
+}
 
-	return s, err
+// stringOrEnv returns value if set, and the value of the environment variable key otherwise
+func stringOrEnv(value, key string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(key)
 }
 
-func validateS3Path(pathSplit []string) error {
-	if len(pathSplit) >= 1 {
-		return nil
+// boolOrEnv returns true if value is set, and the parsed value of the environment variable key otherwise
+func boolOrEnv(value bool, key string) bool {
+	if value {
+		return true
+	}
+	b, _ := strconv.ParseBool(os.Getenv(key))
+	return b
+}
+
+// validateS3Path checks that pathSplit starts with a valid bucket name,
+// followed by a non empty key if keyRequired is set
+func validateS3Path(pathSplit []string, keyRequired bool) error {
+	p := strings.Join(pathSplit, "/")
+	if err := validateS3BucketName(pathSplit[0]); err != nil {
+		return fmt.Errorf("illegal path: %s: %v", p, err)
+	}
+	if keyRequired && strings.Join(pathSplit[1:], "") == "" {
+		return fmt.Errorf("illegal path: %s: missing object key after bucket %q", p, pathSplit[0])
 	}
-	return fmt.Errorf("illegal path: %s", filepath.Join(pathSplit...))
+	return nil
 }
 
+var s3BucketNameRegexp = regexp.MustCompile(`^[a-z0-9.-]+$`)
+
+// validateS3BucketName checks bucket against the S3 bucket naming rules
+func validateS3BucketName(bucket string) error {
+	if bucket == "" {
+		return fmt.Errorf("bucket name is empty")
+	}
+	if len(bucket) < 3 || len(bucket) > 63 {
+		return fmt.Errorf("bucket name %q must be between 3 and 63 characters long", bucket)
+	}
+	if !s3BucketNameRegexp.MatchString(bucket) {
+		return fmt.Errorf("bucket name %q can only contain lowercase letters, numbers, dots and hyphens", bucket)
+	}
+	if strings.HasPrefix(bucket, ".") || strings.HasSuffix(bucket, ".") {
+		return fmt.Errorf("bucket name %q must not start or end with a dot", bucket)
+	}
+	if strings.HasPrefix(bucket, "-") || strings.HasSuffix(bucket, "-") {
+		return fmt.Errorf("bucket name %q must not start or end with a hyphen", bucket)
+	}
+	if strings.Contains(bucket, "..") {
+		return fmt.Errorf("bucket name %q must not contain two adjacent dots", bucket)
+	}
+	return nil
+}
+
+func newS3ObjectInfo(key string, obj types.Object) S3ObjectInfo {
+	return S3ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(obj.Size),
+		LastModified: aws.ToTime(obj.LastModified),
+		ETag:         strings.Trim(aws.ToString(obj.ETag), `"`),
+		StorageClass: string(obj.StorageClass),
+	}
+}
+
+// relativeS3Key returns key relative to prefix, without a leading "/".
+// It returns false if key is neither prefix itself nor an object under it,
+// such as "database/file" for the prefix "data". A trailing "/" of prefix is ignored
+func relativeS3Key(key, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && key != prefix && !strings.HasPrefix(key, prefix+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(key, prefix), "/"), true
+}
+
+// joinS3Key joins prefix, such as a bucket or a path in S3, and key, relative to it, with a
+// single "/". Unlike path.Join, key is kept exactly as listed, as initS3ObjectVariables does
+func joinS3Key(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	if key == "" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + key
+}
+
+// initS3Variables returns the bucket and the object key of split.
+// Keys are always joined with "/", regardless of the OS path separator
 func initS3Variables(split []string) (string, string) {
 	bucket := split[0]
-	path := filepath.Join(split[1:]...)
+	key := path.Join(split[1:]...)
+
+	return bucket, key
+}
 
-	return bucket, path
+// initS3ObjectVariables is initS3Variables for the path of a single object. The key is kept
+// exactly as given, as S3 keys are not file paths: it keeps the trailing slash of a directory
+// marker such as dir/, and the segments path.Join would clean such as // or ..
+func initS3ObjectVariables(split []string) (string, string) {
+	return split[0], strings.Join(split[1:], "/")
 }
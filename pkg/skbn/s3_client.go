@@ -0,0 +1,93 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3API is the subset of the methods of the AWS S3 client used by this package, implemented by
+// *s3.Client. Another implementation, such as a mock, can be passed as the iClient of the functions
+// of this package or to NewS3ClientFromAPI, to use them without AWS
+type S3API interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	ListObjects(ctx context.Context, params *s3.ListObjectsInput, optFns ...func(*s3.Options)) (*s3.ListObjectsOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+	RestoreObject(ctx context.Context, params *s3.RestoreObjectInput, optFns ...func(*s3.Options)) (*s3.RestoreObjectOutput, error)
+	SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error)
+}
+
+var _ S3API = (*s3.Client)(nil)
+
+// S3Client is a connection to S3 to reuse across operations. The functions taking
+// an iClient accept either an *S3Client, the *s3.Client of GetClientToS3 or another S3API
+type S3Client struct {
+	svc S3API
+}
+
+// NewS3Client connects to S3 and checks that the bucket of path can be reached, once
+func NewS3Client(ctx context.Context, path string, config S3Config) (*S3Client, error) {
+	svc, err := GetClientToS3WithConfig(ctx, path, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewS3ClientFromService(svc), nil
+}
+
+// NewS3ClientFromService returns a client using a copy of svc, without checking the connection.
+// The copy returns the errors of this package, such as ErrNotFound or ErrAccessDenied
+func NewS3ClientFromService(svc *s3.Client) *S3Client {
+	return &S3Client{svc: s3.New(svc.Options(), mapErrors)}
+}
+
+// NewS3ClientFromAPI returns a client using api, such as a mock of S3. An *s3.Client is used
+// as with NewS3ClientFromService. Other implementations cannot presign URLs, and their errors
+// are not mapped to the errors of this package: a mock returns ErrNotFound or ErrAccessDenied
+// itself for callers to recognize them
+func NewS3ClientFromAPI(api S3API) *S3Client {
+	if svc, ok := api.(*s3.Client); ok {
+		return NewS3ClientFromService(svc)
+	}
+	return &S3Client{svc: api}
+}
+
+// Service returns the AWS S3 client of the client, or nil if it uses another S3API
+func (c *S3Client) Service() *s3.Client {
+	svc, _ := c.svc.(*s3.Client)
+	return svc
+}
+
+// s3ClientFrom returns the client of iClient, either an *S3Client or an S3API such as an *s3.Client.
+// It returns an error for any other type, or a nil client
+func s3ClientFrom(iClient interface{}) (*S3Client, error) {
+	switch c := iClient.(type) {
+	case *S3Client:
+		if c != nil {
+			return c, nil
+		}
+	case *s3.Client:
+		if c != nil {
+			return NewS3ClientFromService(c), nil
+		}
+	case S3API:
+		return NewS3ClientFromAPI(c), nil
+	}
+	return nil, fmt.Errorf("expected an *S3Client, an *s3.Client or another S3API as the client to S3, got %T", iClient)
+}
@@ -0,0 +1,136 @@
+package skbn_test
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// setTestEnv isolates the configuration of the clients of a test from the environment, with
+// static credentials and a single attempt per request so that retries are those of skbn
+func setTestEnv(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "skbntest")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "skbntest")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+	t.Setenv("AWS_CA_BUNDLE", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+}
+
+// flakyServer forwards the requests to target after answering the first failures with a 500
+// response, and counts them
+func flakyServer(target string, failures int32, requests *atomic.Int32) *httptest.Server {
+	u, _ := url.Parse(target)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+}
+
+func TestGetClientToS3Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"success on attempt 1", 0, false, 1},
+		{"success on attempt 3", 2, false, 3},
+		{"total failure", 3, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestEnv(t)
+			fake := skbntest.NewFakeS3("bucket")
+			defer fake.Close()
+			var requests atomic.Int32
+			flaky := flakyServer(fake.URL(), tt.failures, &requests)
+			defer flaky.Close()
+
+			svc, err := skbn.GetClientToS3WithConfig(context.Background(), "bucket", skbn.S3Config{
+				Retry:          fastRetry,
+				Region:         "us-east-1",
+				Endpoint:       flaky.URL,
+				ForcePathStyle: true,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && svc == nil {
+				t.Error("got no client")
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestGetClientToS3CustomCA(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	target, _ := url.Parse(fake.URL())
+	// The certificate of the server is self-signed, so it is only trusted as a custom CA
+	server := httptest.NewUnstartedServer(httputil.NewSingleHostReverseProxy(target))
+	// The handshakes rejected by the untrusting clients are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	bundlePath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundlePath, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  skbn.S3Config
+		wantErr string
+	}{
+		{"CA bundle file", skbn.S3Config{CABundlePath: bundlePath}, ""},
+		{"CA certificate", skbn.S3Config{CACertPEM: caPEM}, ""},
+		{"untrusted", skbn.S3Config{}, "certificate"},
+		{"bundle without certificate", skbn.S3Config{CACertPEM: []byte("not a certificate")}, "no PEM encoded certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestEnv(t)
+			config := tt.config
+			config.Retry = skbn.RetryConfig{MaxAttempts: 1}
+			config.Region = "us-east-1"
+			config.Endpoint = server.URL
+			config.ForcePathStyle = true
+
+			_, err := skbn.GetClientToS3WithConfig(context.Background(), "bucket", config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want an error about %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/unfernandito/skbn/pkg/utils"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// s3MaxCopyObjectSize is the largest object CopyObject can copy in a single request
+	s3MaxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// s3DefaultCopyPartSize is the default part size of a multipart copy
+	s3DefaultCopyPartSize = 512 * 1024 * 1024
+	// s3MaxUploadParts is the maximum number of parts of a multipart upload
+	s3MaxUploadParts = 10000
+)
+
+// S3CopyOptions holds the options of a server side copy of a single file within S3
+type S3CopyOptions struct {
+	// Verbose logs the progress of the copy with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Retry controls the attempts made for each request of the copy
+	Retry RetryConfig
+	// Timeout bounds the whole copy of a file, including all its attempts and the waits between them.
+	// Once exceeded the copy is aborted with an error wrapping context.DeadlineExceeded.
+	// Zero does not limit it
+	Timeout time.Duration
+	// ContentType replaces the content type of the source file
+	ContentType string
+	// Metadata replaces the user metadata of the source file
+	Metadata map[string]string
+	// MetadataDirective is COPY to preserve the content type and metadata of the source file,
+	// or REPLACE to apply ContentType and Metadata, one of which must then be set. Empty
+	// replaces them if either is set, and copies them otherwise
+	MetadataDirective string
+	// PartSize is the size in bytes of each part when copying files larger than 5GB
+	PartSize int64
+	// Concurrency is the number of parts copied in parallel when copying files larger than 5GB
+	Concurrency int
+}
+
+// CopyWithinS3 copies a single file from srcPath to dstPath without downloading it.
+// The content type and metadata of the source file are preserved
+func CopyWithinS3(ctx context.Context, iClient interface{}, srcPath, dstPath string, verbose bool) error {
+	return CopyWithinS3WithOptions(ctx, iClient, srcPath, dstPath, S3CopyOptions{Verbose: verbose})
+}
+
+// CopyWithinS3WithOptions copies a single file from srcPath to dstPath without downloading it, using opts.
+// Files up to 5GB are copied with CopyObject, larger files with a multipart copy
+func CopyWithinS3WithOptions(ctx context.Context, iClient interface{}, srcPath, dstPath string, opts S3CopyOptions) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.Copy(ctx, srcPath, dstPath, opts)
+}
+
+// Copy copies a single file from srcPath to dstPath without downloading it, using opts.
+// Files up to 5GB are copied with CopyObject, larger files with a multipart copy
+func (c *S3Client) Copy(ctx context.Context, srcPath, dstPath string, opts S3CopyOptions) error {
+	opCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	return timeoutError(ctx, opCtx, opts.Timeout, c.copy(opCtx, srcPath, dstPath, opts))
+}
+
+// copy is Copy, within the timeout of the operation
+func (c *S3Client) copy(ctx context.Context, srcPath, dstPath string, opts S3CopyOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	sSplit := strings.Split(srcPath, "/")
+	if err := validateS3Path(sSplit, true); err != nil {
+		return err
+	}
+	srcBucket, srcKey := initS3ObjectVariables(sSplit)
+
+	dSplit := strings.Split(dstPath, "/")
+	if err := validateS3Path(dSplit, false); err != nil {
+		return err
+	}
+	if len(dSplit) == 1 {
+		dSplit = append(dSplit, lastS3KeySegment(srcKey))
+	}
+	dstBucket, dstKey := initS3ObjectVariables(dSplit)
+
+	head, err := headS3Object(ctx, c.svc, srcBucket, srcKey, "", "", nil)
+	if err != nil {
+		return err
+	}
+
+	cp := &s3Copy{
+		svc:       c.svc,
+		opts:      opts,
+		logger:    resolveLogger(opts.Logger, opts.Verbose),
+		head:      head,
+		source:    s3CopySource(srcBucket, srcKey),
+		dstBucket: dstBucket,
+		dstKey:    dstKey,
+	}
+	desc := fmt.Sprintf("copy file from s3://%s/%s to s3://%s/%s", srcBucket, srcKey, dstBucket, dstKey)
+
+	if aws.ToInt64(head.ContentLength) <= s3MaxCopyObjectSize {
+		return opts.Retry.do(ctx, cp.logger, desc, func() error {
+			return cp.copyObject(ctx)
+		})
+	}
+
+	return cp.copyMultipart(ctx, desc)
+}
+
+// CopyPrefixResult is the outcome of a server side copy of all the files in a prefix
+type CopyPrefixResult struct {
+	// Copied is the number of files copied
+	Copied int
+	// Failed is the number of files that could not be copied
+	Failed int
+}
+
+// CopyPrefix copies all files in srcPrefix (recursive) to dstPrefix without downloading them,
+// using the paths relative to srcPrefix as paths relative to dstPrefix. workers files are
+// copied in parallel, zero uses 10. The copy goes on past the files that fail, which are
+// listed in the returned *MultiError. No file is started once ctx is done
+func CopyPrefix(ctx context.Context, iClient interface{}, srcPrefix, dstPrefix string, workers int) (CopyPrefixResult, error) {
+	return CopyPrefixWithOptions(ctx, iClient, srcPrefix, dstPrefix, workers, S3CopyOptions{})
+}
+
+// CopyPrefixWithOptions copies all files in srcPrefix (recursive) to dstPrefix without downloading
+// them, using opts for each file. See CopyPrefix
+func CopyPrefixWithOptions(ctx context.Context, iClient interface{}, srcPrefix, dstPrefix string, workers int, opts S3CopyOptions) (CopyPrefixResult, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return CopyPrefixResult{}, err
+	}
+	return c.CopyPrefix(ctx, srcPrefix, dstPrefix, workers, opts)
+}
+
+// CopyPrefix copies all files in srcPrefix (recursive) to dstPrefix without downloading them,
+// using the paths relative to srcPrefix as paths relative to dstPrefix and opts for each file.
+// workers files are copied in parallel, zero uses 10. The copy goes on past the files that fail,
+// which are listed in the returned *MultiError. No file is started once ctx is done
+func (c *S3Client) CopyPrefix(ctx context.Context, srcPrefix, dstPrefix string, workers int, opts S3CopyOptions) (CopyPrefixResult, error) {
+	var result CopyPrefixResult
+	if err := opts.validate(); err != nil {
+		return result, err
+	}
+	sSplit := strings.Split(srcPrefix, "/")
+	if err := validateS3Path(sSplit, false); err != nil {
+		return result, err
+	}
+	srcBucket, srcKey := initS3Variables(sSplit)
+	if err := validateS3Path(strings.Split(dstPrefix, "/"), false); err != nil {
+		return result, err
+	}
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	if opts.Logger == nil {
+		opts.Logger = logger
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	bwg := utils.NewBoundedWaitGroup(dirConcurrency(workers))
+	err := listS3Objects(ctx, c.svc, srcBucket, srcKey, S3ListOptions{}, func(obj types.Object) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		relativePath, ok := relativeS3Key(aws.ToString(obj.Key), srcKey)
+		if !ok {
+			return true
+		}
+		src := joinS3Key(srcBucket, aws.ToString(obj.Key))
+		dst := joinS3Key(dstPrefix, relativePath)
+
+		bwg.Add(1)
+		go func() {
+			defer bwg.Done()
+			err := c.Copy(ctx, src, dst, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("s3://%s: %w", src, err))
+				result.Failed++
+				return
+			}
+			result.Copied++
+		}()
+		return true
+	})
+	bwg.Wait()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, ctxErr
+	}
+	if err != nil {
+		return result, fmt.Errorf("could not list s3://%s: %w", srcPrefix, err)
+	}
+	logger.Infof("Copied %d files from s3://%s to s3://%s, %d failed", result.Copied, srcPrefix, dstPrefix, result.Failed)
+	if len(errs) != 0 {
+		return result, &MultiError{Errors: errs}
+	}
+	return result, nil
+}
+
+// s3Copy holds the state of a single server side copy
+type s3Copy struct {
+	svc       S3API
+	opts      S3CopyOptions
+	logger    Logger
+	head      *s3.HeadObjectOutput
+	source    string
+	dstBucket string
+	dstKey    string
+}
+
+// replacesMetadata reports whether the copy applies ContentType or Metadata
+func (opts S3CopyOptions) replacesMetadata() bool {
+	return opts.ContentType != "" || opts.Metadata != nil
+}
+
+// validate checks that the metadata directive can be applied with the other options
+func (opts S3CopyOptions) validate() error {
+	switch types.MetadataDirective(opts.MetadataDirective) {
+	case "":
+	case types.MetadataDirectiveCopy:
+		if opts.replacesMetadata() {
+			return fmt.Errorf("the %s metadata directive cannot be used with a content type or metadata", types.MetadataDirectiveCopy)
+		}
+	case types.MetadataDirectiveReplace:
+		if !opts.replacesMetadata() {
+			return fmt.Errorf("the %s metadata directive requires a content type or metadata", types.MetadataDirectiveReplace)
+		}
+	default:
+		return fmt.Errorf("unsupported metadata directive %q", opts.MetadataDirective)
+	}
+	return nil
+}
+
+func (c *s3Copy) contentType() *string {
+	if c.opts.ContentType != "" {
+		return aws.String(c.opts.ContentType)
+	}
+	return c.head.ContentType
+}
+
+func (c *s3Copy) metadata() map[string]string {
+	if c.opts.Metadata != nil {
+		return c.opts.Metadata
+	}
+	return c.head.Metadata
+}
+
+func (c *s3Copy) copyObject(ctx context.Context) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(c.dstBucket),
+		Key:               aws.String(c.dstKey),
+		CopySource:        aws.String(c.source),
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+	if c.opts.replacesMetadata() {
+		input.MetadataDirective = types.MetadataDirectiveReplace
+		input.ContentType = c.contentType()
+		input.Metadata = c.metadata()
+		input.ContentDisposition = c.head.ContentDisposition
+		input.ContentEncoding = c.head.ContentEncoding
+		input.CacheControl = c.head.CacheControl
+	}
+
+	_, err := c.svc.CopyObject(ctx, input)
+	return err
+}
+
+func (c *s3Copy) copyMultipart(ctx context.Context, desc string) error {
+	size := aws.ToInt64(c.head.ContentLength)
+	partSize := c.opts.PartSize
+	if partSize <= 0 {
+		partSize = s3DefaultCopyPartSize
+	}
+	if minPartSize := (size + s3MaxUploadParts - 1) / s3MaxUploadParts; partSize < minPartSize {
+		partSize = minPartSize
+	}
+	concurrency := c.opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 5
+	}
+
+	var uploadID *string
+	err := c.opts.Retry.do(ctx, c.logger, "start multipart "+desc, func() error {
+		out, err := c.svc.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:             aws.String(c.dstBucket),
+			Key:                aws.String(c.dstKey),
+			ContentType:        c.contentType(),
+			Metadata:           c.metadata(),
+			ContentDisposition: c.head.ContentDisposition,
+			ContentEncoding:    c.head.ContentEncoding,
+			CacheControl:       c.head.CacheControl,
+		})
+		if err != nil {
+			return err
+		}
+		uploadID = out.UploadId
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var parts []types.CompletedPart
+	var mu sync.Mutex
+	var firstErr error
+	bwg := utils.NewBoundedWaitGroup(concurrency)
+	for partNumber, start := int32(1), int64(0); start < size; partNumber, start = partNumber+1, start+partSize {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		bwg.Add(1)
+		go func(partNumber int32, start, end int64) {
+			defer bwg.Done()
+			partDesc := fmt.Sprintf("copy part %d of %s", partNumber, desc)
+			err := c.opts.Retry.do(ctx, c.logger, partDesc, func() error {
+				out, err := c.svc.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+					Bucket:          aws.String(c.dstBucket),
+					Key:             aws.String(c.dstKey),
+					UploadId:        uploadID,
+					PartNumber:      aws.Int32(partNumber),
+					CopySource:      aws.String(c.source),
+					CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+				})
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				parts = append(parts, types.CompletedPart{ETag: out.CopyPartResult.ETag, PartNumber: aws.Int32(partNumber)})
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(partNumber, start, end)
+	}
+	bwg.Wait()
+
+	if firstErr == nil {
+		sort.Slice(parts, func(i, j int) bool {
+			return aws.ToInt32(parts[i].PartNumber) < aws.ToInt32(parts[j].PartNumber)
+		})
+		firstErr = c.opts.Retry.do(ctx, c.logger, "complete multipart "+desc, func() error {
+			_, err := c.svc.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+				Bucket:          aws.String(c.dstBucket),
+				Key:             aws.String(c.dstKey),
+				UploadId:        uploadID,
+				MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+			})
+			return err
+		})
+	}
+	if firstErr != nil {
+		// Do not leave the copied parts behind, they are billed until aborted
+		c.svc.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(c.dstBucket),
+			Key:      aws.String(c.dstKey),
+			UploadId: uploadID,
+		})
+		return firstErr
+	}
+
+	return nil
+}
+
+// lastS3KeySegment returns the last segment of key, the name of a file copied to a bucket
+// only. Unlike path.Base, the trailing slash of a directory marker such as dir/sub/ is kept
+func lastS3KeySegment(key string) string {
+	name := strings.TrimSuffix(key, "/")
+	name = name[strings.LastIndex(name, "/")+1:]
+	if strings.HasSuffix(key, "/") {
+		name += "/"
+	}
+	return name
+}
+
+// s3CopySource returns the URL encoded source of a copy request
+func s3CopySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		// url.PathEscape keeps "+", which S3 would decode as a space
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
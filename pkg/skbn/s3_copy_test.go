@@ -0,0 +1,176 @@
+package skbn
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestS3CopySource(t *testing.T) {
+	tests := []struct {
+		bucket, key, want string
+	}{
+		{"bucket", "file.txt", "bucket/file.txt"},
+		{"bucket", "dir/file.txt", "bucket/dir/file.txt"},
+		{"bucket", "my file #1 (draft)?.txt", "bucket/my%20file%20%231%20%28draft%29%3F.txt"},
+		{"bucket", "a+b&c=d.txt", "bucket/a%2Bb%26c%3Dd.txt"},
+		{"bucket", "файл.txt", "bucket/%D1%84%D0%B0%D0%B9%D0%BB.txt"},
+		{"bucket", "dir/", "bucket/dir/"},
+		{"bucket", "a//b", "bucket/a//b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := s3CopySource(tt.bucket, tt.key); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinS3Key(t *testing.T) {
+	tests := []struct {
+		prefix, key, want string
+	}{
+		{"bucket", "file", "bucket/file"},
+		{"bucket/", "file", "bucket/file"},
+		{"bucket/dir", "sub/file", "bucket/dir/sub/file"},
+		{"bucket/dir", "sub/", "bucket/dir/sub/"},
+		{"bucket/dir", "/file", "bucket/dir//file"},
+		{"bucket/dir", "a/../b", "bucket/dir/a/../b"},
+		{"bucket/dir", "", "bucket/dir"},
+		{"", "dir/", "dir/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+"+"+tt.key, func(t *testing.T) {
+			if got := joinS3Key(tt.prefix, tt.key); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastS3KeySegment(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{"file.txt", "file.txt"},
+		{"dir/file.txt", "file.txt"},
+		{"dir/", "dir/"},
+		{"dir/sub/", "sub/"},
+		{"dir/my file #1.txt", "my file #1.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := lastS3KeySegment(tt.key); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+const gib = 1024 * 1024 * 1024
+
+// largeCopy is a file of size bytes copied part by part, failing the copy of failPart if set
+type largeCopy struct {
+	S3API
+	size     int64
+	failPart int32
+
+	mu        sync.Mutex
+	ranges    map[int32]string
+	completed []types.CompletedPart
+	aborted   string
+}
+
+func (l *largeCopy) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(l.size), ETag: aws.String(`"etag"`), ContentType: aws.String("text/plain")}, nil
+}
+
+func (l *largeCopy) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	panic("a file larger than 5GB cannot be copied with CopyObject")
+}
+
+func (l *largeCopy) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (l *largeCopy) UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	partNumber := aws.ToInt32(params.PartNumber)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ranges == nil {
+		l.ranges = map[int32]string{}
+	}
+	l.ranges[partNumber] = aws.ToString(params.CopySourceRange)
+	if partNumber == l.failPart {
+		return nil, &smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"}
+	}
+	return &s3.UploadPartCopyOutput{CopyPartResult: &types.CopyPartResult{ETag: aws.String(string(rune('a' + partNumber)))}}, nil
+}
+
+func (l *largeCopy) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.completed = params.MultipartUpload.Parts
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (l *largeCopy) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.aborted = aws.ToString(params.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestCopyMultipart(t *testing.T) {
+	size := int64(5*gib + 1)
+	wantRanges := map[int32]string{
+		1: "bytes=0-2147483647",
+		2: "bytes=2147483648-4294967295",
+		3: "bytes=4294967296-5368709120",
+	}
+	api := &largeCopy{size: size}
+
+	err := CopyWithinS3WithOptions(context.Background(), api, "bucket/big", "bucket/copy", S3CopyOptions{PartSize: 2 * gib})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(api.ranges, wantRanges) {
+		t.Errorf("got part ranges %v, want %v", api.ranges, wantRanges)
+	}
+	var completed []int32
+	for _, part := range api.completed {
+		completed = append(completed, aws.ToInt32(part.PartNumber))
+		if want := string(rune('a' + aws.ToInt32(part.PartNumber))); aws.ToString(part.ETag) != want {
+			t.Errorf("got ETag %q completing part %d, want %q", aws.ToString(part.ETag), aws.ToInt32(part.PartNumber), want)
+		}
+	}
+	if !sort.SliceIsSorted(completed, func(i, j int) bool { return completed[i] < completed[j] }) || len(completed) != 3 {
+		t.Errorf("got parts %v completed, want 1, 2 and 3 in order", completed)
+	}
+	if api.aborted != "" {
+		t.Errorf("got upload %s aborted after a copy", api.aborted)
+	}
+}
+
+func TestCopyMultipartAbortsOnFailure(t *testing.T) {
+	api := &largeCopy{size: 6 * gib, failPart: 2}
+
+	err := CopyWithinS3WithOptions(context.Background(), api, "bucket/big", "bucket/copy", S3CopyOptions{PartSize: 2 * gib, Concurrency: 1})
+	if err == nil {
+		t.Fatal("got no error with a failed part")
+	}
+	if api.completed != nil {
+		t.Errorf("got parts %v completed after a failure", api.completed)
+	}
+	if api.aborted != "upload-id" {
+		t.Errorf("got upload %q aborted, want upload-id", api.aborted)
+	}
+}
@@ -0,0 +1,399 @@
+package skbn
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/unfernandito/skbn/pkg/utils"
+)
+
+// S3DirOptions holds the options of a transfer of a whole directory to or from S3
+type S3DirOptions struct {
+	// Verbose logs the progress of the transfer with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Concurrency is the number of files transferred in parallel. Zero uses 10
+	Concurrency int
+	// FollowSymlinks uploads the files and directories symbolic links point to.
+	// Symbolic links are skipped if not set
+	FollowSymlinks bool
+	// Overwrite controls which existing local files are replaced by a download
+	Overwrite OverwritePolicy
+	// Upload holds the options of the upload of each file. Its Size is set for each file
+	Upload S3UploadOptions
+	// Download holds the options of the download of each file
+	Download S3DownloadOptions
+	// List holds the options of the listing of the files to download
+	List S3ListOptions
+}
+
+// OverwritePolicy controls which existing local files are replaced by a download
+type OverwritePolicy int
+
+const (
+	// OverwriteAlways replaces existing files
+	OverwriteAlways OverwritePolicy = iota
+	// OverwriteSkipExisting keeps existing files
+	OverwriteSkipExisting
+	// OverwriteIfNewer replaces existing files modified before the file in S3
+	OverwriteIfNewer
+)
+
+// FileTransferResult is the outcome of the transfer of a single file of a directory
+type FileTransferResult struct {
+	// LocalPath is the path of the file on the local file system
+	LocalPath string
+	// S3Path is the path of the file in S3, including the bucket
+	S3Path string
+	// BytesTransferred is the number of bytes transferred
+	BytesTransferred int64
+	// Err is the error of the transfer, if any
+	Err error
+}
+
+// UploadDirToS3 uploads all files under localDir (recursive) to toPrefix, using the paths
+// relative to localDir as paths relative to toPrefix. It returns the result of each file,
+// and an error listing the files that could not be uploaded
+func UploadDirToS3(ctx context.Context, iClient interface{}, toPrefix, localDir string, opts S3DirOptions) ([]FileTransferResult, error) {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	pSplit := strings.Split(toPrefix, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
+
+	files, err := walkLocalDir(localDir, opts.FollowSymlinks, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	results := uploadLocalFiles(ctx, iClient, toPrefix, files, opts, logger)
+	return results, dirTransferError("upload", results, ctx.Err())
+}
+
+// UploadFSToS3 uploads all files under root (recursive) of fsys, such as an embed.FS or an
+// fstest.MapFS, to toPrefix, using the paths relative to root as paths relative to toPrefix.
+// A root of "." uploads the whole fsys. Only regular files are uploaded, and
+// opts.FollowSymlinks is ignored. The LocalPath of each result is the path of the file in fsys.
+// It returns the result of each file, and an error listing the files that could not be uploaded
+func UploadFSToS3(ctx context.Context, iClient interface{}, toPrefix string, fsys fs.FS, root string, opts S3DirOptions) ([]FileTransferResult, error) {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	pSplit := strings.Split(toPrefix, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
+
+	files, err := walkFS(fsys, root, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	results := uploadFiles(ctx, iClient, toPrefix, files, func(name string) (io.ReadCloser, error) {
+		return fsys.Open(name)
+	}, opts, logger)
+	return results, dirTransferError("upload", results, ctx.Err())
+}
+
+// uploadLocalFiles uploads files of the local file system to toPrefix in parallel and returns
+// the result of each file. Files are not started once ctx is done
+func uploadLocalFiles(ctx context.Context, iClient interface{}, toPrefix string, files []localFile, opts S3DirOptions, logger Logger) []FileTransferResult {
+	return uploadFiles(ctx, iClient, toPrefix, files, func(name string) (io.ReadCloser, error) {
+		return os.Open(name)
+	}, opts, logger)
+}
+
+// uploadFiles uploads files, read with open, to toPrefix in parallel and returns the result
+// of each file. Files are not started once ctx is done
+func uploadFiles(ctx context.Context, iClient interface{}, toPrefix string, files []localFile, open func(name string) (io.ReadCloser, error), opts S3DirOptions, logger Logger) []FileTransferResult {
+	results := make([]FileTransferResult, len(files))
+	started := 0
+	bwg := utils.NewBoundedWaitGroup(dirConcurrency(opts.Concurrency))
+	for i, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		started++
+		results[i] = FileTransferResult{
+			LocalPath: file.path,
+			S3Path:    joinS3Key(toPrefix, filepath.ToSlash(file.rel)),
+		}
+
+		bwg.Add(1)
+		go func(r *FileTransferResult, size int64) {
+			defer bwg.Done()
+			f, err := open(r.LocalPath)
+			if err != nil {
+				r.Err = err
+				return
+			}
+			defer f.Close()
+
+			uploadOpts := opts.Upload
+			uploadOpts.Size = size
+			if uploadOpts.Logger == nil {
+				uploadOpts.Logger = logger
+			}
+			res, err := UploadToS3WithOptions(ctx, iClient, r.S3Path, r.LocalPath, f, uploadOpts)
+			r.BytesTransferred = res.BytesTransferred
+			r.Err = err
+		}(&results[i], file.size)
+	}
+	bwg.Wait()
+
+	return results[:started]
+}
+
+// CreateDirMarker creates the empty file of path with a key ending in "/", such as bucket/dir/,
+// which the S3 console and other tools show as a directory. The slash is added if missing
+func CreateDirMarker(ctx context.Context, iClient interface{}, path string) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.CreateDirMarker(ctx, path)
+}
+
+// CreateDirMarker creates the empty file of path with a key ending in "/", such as bucket/dir/,
+// which the S3 console and other tools show as a directory. The slash is added if missing
+func (c *S3Client) CreateDirMarker(ctx context.Context, path string) error {
+	if err := validateS3Path(strings.Split(path, "/"), true); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	_, err := c.Upload(ctx, path, "", bytes.NewReader(nil), S3UploadOptions{ContentType: dirMarkerContentType})
+	return err
+}
+
+// dirMarkerContentType is the content type of the directory markers created by the S3 console
+const dirMarkerContentType = "application/x-directory"
+
+// DownloadPrefixToDir downloads all files in fromPrefix (recursive) to localDir, using the paths
+// relative to fromPrefix as paths relative to localDir, and creating directories as needed.
+// The modification time of each file is set to the one of the file in S3. It returns the
+// result of each file, and an error listing the files that could not be downloaded
+func DownloadPrefixToDir(ctx context.Context, iClient interface{}, fromPrefix, localDir string, opts S3DirOptions) ([]FileTransferResult, error) {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	infos, err := GetFileInfoFromS3WithOptions(ctx, iClient, fromPrefix, opts.List)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []FileTransferResult
+	var modTimes []time.Time
+	for _, info := range infos {
+		// Keys ending with a slash are folder placeholders, not files
+		if info.Key == "" || strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+		localPath := filepath.Join(localDir, filepath.FromSlash(info.Key))
+		r := FileTransferResult{LocalPath: localPath, S3Path: joinS3Key(fromPrefix, info.Key)}
+		if rel, err := filepath.Rel(localDir, localPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			r.Err = fmt.Errorf("key %s is outside of %s", info.Key, localDir)
+		} else if skip, err := skipDownload(localPath, info.LastModified, opts.Overwrite); err != nil {
+			r.Err = err
+		} else if skip {
+			logger.Debugf("Skipping %s: the local file is kept", localPath)
+			continue
+		}
+		results = append(results, r)
+		modTimes = append(modTimes, info.LastModified)
+	}
+
+	downloadS3Files(ctx, iClient, results, modTimes, opts, logger)
+	return results, dirTransferError("download", results, ctx.Err())
+}
+
+// downloadS3Files downloads the files of results in parallel, setting the modification time
+// of each to modTimes. Results that already failed, and files once ctx is done, are not started
+func downloadS3Files(ctx context.Context, iClient interface{}, results []FileTransferResult, modTimes []time.Time, opts S3DirOptions, logger Logger) {
+	bwg := utils.NewBoundedWaitGroup(dirConcurrency(opts.Concurrency))
+	for i := range results {
+		if ctx.Err() != nil {
+			break
+		}
+		if results[i].Err != nil {
+			continue
+		}
+
+		bwg.Add(1)
+		go func(r *FileTransferResult, modTime time.Time) {
+			defer bwg.Done()
+			downloadOpts := opts.Download
+			if downloadOpts.Logger == nil {
+				downloadOpts.Logger = logger
+			}
+			r.BytesTransferred, r.Err = downloadToFile(ctx, iClient, r.S3Path, r.LocalPath, modTime, downloadOpts)
+		}(&results[i], modTimes[i])
+	}
+	bwg.Wait()
+}
+
+// skipDownload reports whether the download to localPath of a file last modified at modTime
+// is skipped according to policy
+func skipDownload(localPath string, modTime time.Time, policy OverwritePolicy) (bool, error) {
+	if policy == OverwriteAlways {
+		return false, nil
+	}
+	info, err := os.Stat(localPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if policy == OverwriteIfNewer {
+		return !info.ModTime().Before(modTime), nil
+	}
+	return true, nil
+}
+
+// downloadToFile downloads a single file from S3 to localPath, and sets its modification time to modTime.
+// The file is downloaded atomically, a failed download leaves localPath as it was
+func downloadToFile(ctx context.Context, iClient interface{}, s3Path, localPath string, modTime time.Time, opts S3DownloadOptions) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return 0, err
+	}
+	res, err := DownloadToFileWithOptions(ctx, iClient, s3Path, localPath, opts)
+	if err != nil {
+		return res.BytesTransferred, err
+	}
+	return res.BytesTransferred, os.Chtimes(localPath, modTime, modTime)
+}
+
+// localFile is a file found under a local directory
+type localFile struct {
+	path    string
+	rel     string
+	size    int64
+	modTime time.Time
+}
+
+// walkLocalDir returns the regular files under dir (recursive), with their path relative to dir
+func walkLocalDir(dir string, followSymlinks bool, logger Logger) ([]localFile, error) {
+	var files []localFile
+	visited := make(map[string]bool)
+
+	var walk func(root, relRoot string) error
+	walk = func(root, relRoot string) error {
+		// Guard against symbolic links pointing to a parent directory
+		real, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return err
+		}
+		if visited[real] {
+			logger.Infof("Skipping %s: already walked", root)
+			return nil
+		}
+		visited[real] = true
+
+		return filepath.WalkDir(real, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(real, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.Join(relRoot, rel)
+
+			if d.Type()&fs.ModeSymlink != 0 {
+				if !followSymlinks {
+					logger.Debugf("Skipping symbolic link %s", p)
+					return nil
+				}
+				info, err := os.Stat(p)
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return walk(p, rel)
+				}
+				files = append(files, localFile{path: p, rel: rel, size: info.Size(), modTime: info.ModTime()})
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files = append(files, localFile{path: p, rel: rel, size: info.Size(), modTime: info.ModTime()})
+			return nil
+		})
+	}
+
+	if err := walk(dir, ""); err != nil {
+		return nil, fmt.Errorf("could not walk %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// walkFS returns the regular files under root of fsys, with their paths relative to root
+func walkFS(fsys fs.FS, root string, logger Logger) ([]localFile, error) {
+	var files []localFile
+	err := fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			logger.Infof("Skipping %s: not a regular file", p)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel := p
+		if p == root {
+			// root is a single file
+			rel = path.Base(p)
+		} else if root != "." {
+			rel = strings.TrimPrefix(p, root+"/")
+		}
+		files = append(files, localFile{path: p, rel: rel, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not walk %s: %w", root, err)
+	}
+	return files, nil
+}
+
+// dirConcurrency returns the number of files transferred in parallel
+func dirConcurrency(concurrency int) int {
+	if concurrency <= 0 {
+		return 10
+	}
+	return concurrency
+}
+
+// dirTransferError returns an error listing the files of results that failed, if any
+func dirTransferError(action string, results []FileTransferResult, ctxErr error) error {
+	if ctxErr != nil {
+		return ctxErr
+	}
+	var failed []string
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", r.LocalPath, r.Err))
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("could not %s %d of %d files: %s", action, len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
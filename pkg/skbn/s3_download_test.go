@@ -0,0 +1,76 @@
+package skbn_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// writeSeeker hides the methods of f other than Write and Seek, so parts are written at
+// their offsets by seeking
+type writeSeeker struct {
+	io.WriteSeeker
+}
+
+// appendOnly hides the methods of w other than Write, like a pipe
+type appendOnly struct {
+	io.Writer
+}
+
+func TestDownloadConcurrentParts(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	// Larger than 2 parts of 5MB, each with a distinct content
+	content := make([]byte, 12*1024*1024+123)
+	for i := range content {
+		content[i] = byte(i * 7 / 1024)
+	}
+	fake.PutObject("bucket", "file", content)
+
+	tests := []struct {
+		name   string
+		writer func(t *testing.T) (io.Writer, func() []byte)
+		verify bool
+	}{
+		{"not seekable", func(t *testing.T) (io.Writer, func() []byte) {
+			var buf bytes.Buffer
+			return appendOnly{&buf}, buf.Bytes
+		}, false},
+		{"not seekable verified", func(t *testing.T) (io.Writer, func() []byte) {
+			var buf bytes.Buffer
+			return appendOnly{&buf}, buf.Bytes
+		}, true},
+		{"seekable", func(t *testing.T) (io.Writer, func() []byte) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { f.Close() })
+			return writeSeeker{f}, func() []byte {
+				b, _ := os.ReadFile(f.Name())
+				return b
+			}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, written := tt.writer(t)
+			result, err := skbn.DownloadFromS3WithOptions(context.Background(), fake.Service(), "bucket/file", w, skbn.S3DownloadOptions{Concurrency: 4, VerifyChecksum: tt.verify})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.BytesTransferred != int64(len(content)) {
+				t.Errorf("got %d bytes transferred, want %d", result.BytesTransferred, len(content))
+			}
+			if got := written(); !bytes.Equal(got, content) {
+				t.Errorf("got %d bytes written differing from the %d bytes of the file", len(got), len(content))
+			}
+		})
+	}
+}
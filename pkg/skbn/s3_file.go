@@ -0,0 +1,91 @@
+package skbn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// tempFileSuffix ends the name of the temporary file a file is downloaded to before it is
+// renamed, next to the local path
+const tempFileSuffix = ".tmp"
+
+// DownloadToFile downloads a single file from S3 to localPath atomically: the content is
+// written to a temporary file in the same directory, synced to disk and renamed to localPath
+// once complete, so localPath never holds a partial download. The temporary file is removed
+// if the download fails, and a file already at localPath is left as it was
+func DownloadToFile(ctx context.Context, iClient interface{}, path, localPath string, verbose bool) error {
+	_, err := DownloadToFileWithOptions(ctx, iClient, path, localPath, S3DownloadOptions{Verbose: verbose})
+	return err
+}
+
+// DownloadToFileWithOptions downloads a single file from S3 to localPath atomically using opts.
+// Parts are written in parallel, up to opts.Concurrency, to the temporary file, see DownloadToFile
+func DownloadToFileWithOptions(ctx context.Context, iClient interface{}, path, localPath string, opts S3DownloadOptions) (TransferResult, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	return c.DownloadToFile(ctx, path, localPath, opts)
+}
+
+// DownloadToFile downloads a single file from S3 to localPath atomically using opts,
+// through a temporary file renamed once complete. See DownloadToFileWithOptions
+func (c *S3Client) DownloadToFile(ctx context.Context, path, localPath string, opts S3DownloadOptions) (TransferResult, error) {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	dir, name := filepath.Split(localPath)
+	if name == "" {
+		return TransferResult{}, fmt.Errorf("%s is a directory, a file name is required to download to", localPath)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	f, err := createTempFile(dir, name)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	tmpPath := f.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			// Closing again after a failed sync or rename only returns an error
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	result, err := c.Download(ctx, path, f, opts)
+	if err != nil {
+		return result, err
+	}
+	if err := f.Sync(); err != nil {
+		return result, fmt.Errorf("could not sync %s: %w", tmpPath, err)
+	}
+	if err := f.Close(); err != nil {
+		return result, fmt.Errorf("could not close %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, localPath); err != nil {
+		return result, fmt.Errorf("could not move the download to %s: %w", localPath, err)
+	}
+	committed = true
+	logger.Debugf("Moved %s to %s", tmpPath, localPath)
+	return result, nil
+}
+
+// createTempFile creates a new temporary file in dir for the download of name. Unlike
+// os.CreateTemp it is created with the mode of the downloaded files, less the umask, as it
+// becomes the file once renamed
+func createTempFile(dir, name string) (*os.File, error) {
+	for try := 0; ; try++ {
+		tmpPath := filepath.Join(dir, name+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+tempFileSuffix)
+		f, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
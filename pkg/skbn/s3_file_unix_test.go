@@ -0,0 +1,45 @@
+//go:build unix
+
+package skbn_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+func TestDownloadToFileHonorsUmask(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "file", []byte("content"))
+
+	tests := []struct {
+		umask int
+		want  os.FileMode
+	}{
+		{0022, 0644},
+		{0077, 0600},
+		{0027, 0640},
+	}
+	for _, tt := range tests {
+		t.Run(os.FileMode(tt.umask).String(), func(t *testing.T) {
+			defer syscall.Umask(syscall.Umask(tt.umask))
+			localPath := filepath.Join(t.TempDir(), "file")
+			if err := skbn.DownloadToFile(context.Background(), fake.Client(), "bucket/file", localPath, false); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(localPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != tt.want {
+				t.Errorf("got mode %v, want %v", mode, tt.want)
+			}
+		})
+	}
+}
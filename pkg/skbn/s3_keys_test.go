@@ -0,0 +1,111 @@
+package skbn_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// unusualKeys are keys that naive splitting, joining or escaping would change
+var unusualKeys = []string{
+	"my file #1 (draft)?.txt",
+	"файл.txt",
+	"a+b&c=d%20.txt",
+	"dir/sub dir/file.txt",
+	"dir//file.txt",
+}
+
+func TestKeysRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	client := fake.Service()
+
+	for _, key := range unusualKeys {
+		content := []byte("content of " + key)
+		if _, err := skbn.UploadToS3WithOptions(ctx, client, "bucket/src/"+key, key, bytes.NewReader(content), skbn.S3UploadOptions{}); err != nil {
+			t.Fatalf("upload of %q: %v", key, err)
+		}
+		var downloaded bytes.Buffer
+		if err := skbn.DownloadFromS3(ctx, client, "bucket/src/"+key, &downloaded, false); err != nil {
+			t.Fatalf("download of %q: %v", key, err)
+		}
+		if !bytes.Equal(downloaded.Bytes(), content) {
+			t.Errorf("got content %q downloaded from %q, want %q", downloaded.Bytes(), key, content)
+		}
+		if err := skbn.CopyWithinS3(ctx, client, "bucket/src/"+key, "bucket/copy/"+key, false); err != nil {
+			t.Fatalf("copy of %q: %v", key, err)
+		}
+		if got, _ := fake.Object("bucket", "copy/"+key); !bytes.Equal(got, content) {
+			t.Errorf("got content %q copied from %q, want %q", got, key, content)
+		}
+	}
+
+	listed, err := skbn.GetListOfFilesFromS3(ctx, client, "bucket/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]string(nil), unusualKeys...)
+	sort.Strings(want)
+	sort.Strings(listed)
+	if !reflect.DeepEqual(listed, want) {
+		t.Errorf("got keys %q listed, want %q", listed, want)
+	}
+
+	if _, err := skbn.CopyPrefix(ctx, client, "bucket/src", "bucket/prefix", 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range unusualKeys {
+		if got, ok := fake.Object("bucket", "prefix/"+key); !ok || !bytes.Equal(got, []byte("content of "+key)) {
+			t.Errorf("got content %q copied with the prefix from %q, want %q", got, key, "content of "+key)
+		}
+	}
+}
+
+func TestSyncToS3MirrorDeletesListedKey(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "dir/a/b.txt", []byte("kept"))
+	fake.PutObject("bucket", "dir/a//b.txt", []byte("deleted"))
+	localDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(localDir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(localDir, "a", "b.txt"), []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := skbn.SyncToS3(context.Background(), fake.Service(), "bucket/dir", localDir, skbn.S3SyncOptions{Mirror: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 1 {
+		t.Errorf("got %d files deleted, want 1", result.Deleted)
+	}
+	if got, want := fake.Keys("bucket"), []string{"dir/a/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %q after the sync, want %q", got, want)
+	}
+}
+
+func TestCopyDirMarkerToBucket(t *testing.T) {
+	ctx := context.Background()
+	fake := skbntest.NewFakeS3("bucket", "other")
+	defer fake.Close()
+	if err := skbn.CreateDirMarker(ctx, fake.Service(), "bucket/dir/sub/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := skbn.CopyWithinS3(ctx, fake.Service(), "bucket/dir/sub/", "other", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.Keys("other"), []string{"sub/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %q in the bucket copied to, want %q", got, want)
+	}
+}
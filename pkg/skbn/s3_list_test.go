@@ -0,0 +1,142 @@
+package skbn_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+)
+
+// pagedBucket lists keys, sorted, in pages of up to 1000 keys like S3. ListObjects pages
+// continue after a marker and ListObjectsV2 pages after an opaque continuation token
+type pagedBucket struct {
+	skbn.S3API
+	keys     []string
+	requests int
+}
+
+// page returns the keys under prefix after the index start, up to maxKeys, and whether more follow
+func (b *pagedBucket) page(prefix string, start int, maxKeys int32) ([]types.Object, int, bool) {
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+	b.requests++
+	var contents []types.Object
+	i := start
+	for ; i < len(b.keys) && len(contents) < int(maxKeys); i++ {
+		if strings.HasPrefix(b.keys[i], prefix) {
+			contents = append(contents, types.Object{Key: aws.String(b.keys[i]), Size: aws.Int64(1)})
+		}
+	}
+	return contents, i, i < len(b.keys)
+}
+
+func (b *pagedBucket) ListObjects(ctx context.Context, params *s3.ListObjectsInput, optFns ...func(*s3.Options)) (*s3.ListObjectsOutput, error) {
+	start := sort.SearchStrings(b.keys, aws.ToString(params.Marker))
+	if start < len(b.keys) && b.keys[start] == aws.ToString(params.Marker) {
+		start++
+	}
+	contents, _, truncated := b.page(aws.ToString(params.Prefix), start, aws.ToInt32(params.MaxKeys))
+	// Without a delimiter S3 returns no NextMarker, the next page starts after the last key
+	return &s3.ListObjectsOutput{Contents: contents, IsTruncated: aws.Bool(truncated)}, nil
+}
+
+func (b *pagedBucket) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	start := 0
+	if token := aws.ToString(params.ContinuationToken); token != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(token, "token-"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid continuation token %q", token)
+		}
+		start = n
+	}
+	contents, next, truncated := b.page(aws.ToString(params.Prefix), start, aws.ToInt32(params.MaxKeys))
+	out := &s3.ListObjectsV2Output{Contents: contents, IsTruncated: aws.Bool(truncated), KeyCount: aws.Int32(int32(len(contents)))}
+	if truncated {
+		out.NextContinuationToken = aws.String("token-" + strconv.Itoa(next))
+	}
+	return out, nil
+}
+
+// newPagedBucket returns a bucket of n keys under dir/
+func newPagedBucket(n int) *pagedBucket {
+	b := &pagedBucket{}
+	for i := 0; i < n; i++ {
+		b.keys = append(b.keys, fmt.Sprintf("dir/file-%05d", i))
+	}
+	sort.Strings(b.keys)
+	return b
+}
+
+// checkListed fails t unless files holds each of the n files of newPagedBucket exactly once
+func checkListed(t *testing.T, files []string, n int) {
+	t.Helper()
+	seen := make(map[string]int, len(files))
+	for _, f := range files {
+		seen[f]++
+	}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("file-%05d", i)
+		if seen[name] != 1 {
+			t.Errorf("got %s listed %d times, want once", name, seen[name])
+		}
+	}
+	if len(files) != n {
+		t.Errorf("got %d files listed, want %d", len(files), n)
+	}
+}
+
+func TestListPastPageBoundary(t *testing.T) {
+	const n = 2500
+	for _, v1 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ListObjectsV1 %v", v1), func(t *testing.T) {
+			t.Setenv("AWS_S3_LIST_OBJECTS_V1", "")
+			bucket := newPagedBucket(n)
+			files, err := skbn.GetListOfFilesFromS3WithOptions(context.Background(), bucket, "bucket/dir", skbn.S3ListOptions{ListObjectsV1: v1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkListed(t, files, n)
+			if bucket.requests != 3 {
+				t.Errorf("got %d list requests, want 3", bucket.requests)
+			}
+		})
+	}
+}
+
+func TestListPagePastPageBoundary(t *testing.T) {
+	const n = 2500
+	for _, v1 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ListObjectsV1 %v", v1), func(t *testing.T) {
+			t.Setenv("AWS_S3_LIST_OBJECTS_V1", "")
+			bucket := newPagedBucket(n)
+			var files []string
+			token := ""
+			for pages := 1; ; pages++ {
+				page, err := skbn.GetFileInfoPageFromS3(context.Background(), bucket, "bucket/dir", token, skbn.S3ListOptions{ListObjectsV1: v1})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, f := range page.Files {
+					files = append(files, f.Key)
+				}
+				if page.NextToken == "" {
+					break
+				}
+				if pages == n {
+					t.Fatal("the listing does not end")
+				}
+				token = page.NextToken
+			}
+			checkListed(t, files, n)
+		})
+	}
+}
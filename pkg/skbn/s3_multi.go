@@ -0,0 +1,87 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/unfernandito/skbn/pkg/utils"
+)
+
+// GetListOfFilesFromS3Multi gets the lists of files in each of prefixes of bucket from S3
+// (recursive), listing up to 10 prefixes in parallel. See GetListOfFilesFromS3MultiWithOptions
+func GetListOfFilesFromS3Multi(ctx context.Context, iClient interface{}, bucket string, prefixes []string) (map[string][]string, error) {
+	return GetListOfFilesFromS3MultiWithOptions(ctx, iClient, bucket, prefixes, 0, S3ListOptions{})
+}
+
+// GetListOfFilesFromS3MultiWithOptions gets the lists of files in each of prefixes of bucket
+// from S3 (recursive) using opts, by prefix. The files are relative to their prefix, as with
+// GetListOfFilesFromS3. workers prefixes are listed in parallel, zero uses 10. The listing
+// goes on past the prefixes that fail, which are missing from the result and listed in the
+// returned *MultiError. No prefix is started once ctx is done
+func GetListOfFilesFromS3MultiWithOptions(ctx context.Context, iClient interface{}, bucket string, prefixes []string, workers int, opts S3ListOptions) (map[string][]string, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListMulti(ctx, bucket, prefixes, workers, opts)
+}
+
+// ListMulti gets the lists of files in each of prefixes of bucket from S3 (recursive) using
+// opts, by prefix, listing workers prefixes in parallel. See GetListOfFilesFromS3MultiWithOptions
+func (c *S3Client) ListMulti(ctx context.Context, bucket string, prefixes []string, workers int, opts S3ListOptions) (map[string][]string, error) {
+	if err := validateS3BucketName(bucket); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	results := make(map[string][]string, len(prefixes))
+	errs := make([]error, len(prefixes))
+	seen := make(map[string]bool, len(prefixes))
+	bwg := utils.NewBoundedWaitGroup(dirConcurrency(workers))
+	for i, prefix := range prefixes {
+		if ctx.Err() != nil {
+			break
+		}
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+
+		bwg.Add(1)
+		go func(i int, prefix string) {
+			defer bwg.Done()
+			p := bucket
+			if prefix != "" {
+				p += "/" + prefix
+			}
+			infos, err := c.List(ctx, p, opts)
+			if err != nil {
+				errs[i] = fmt.Errorf("could not list s3://%s: %w", p, err)
+				return
+			}
+			files := make([]string, 0, len(infos))
+			for _, info := range infos {
+				files = append(files, info.Key)
+			}
+			mu.Lock()
+			results[prefix] = files
+			mu.Unlock()
+		}(i, prefix)
+	}
+	bwg.Wait()
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return results, ctxErr
+	}
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) != 0 {
+		return results, &MultiError{Errors: failed}
+	}
+	return results, nil
+}
@@ -0,0 +1,90 @@
+package skbn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// CleanupMultipartUploads aborts the multipart uploads in path that were started more than
+// olderThan ago, and returns the number of aborted uploads. Their parts are deleted
+func CleanupMultipartUploads(ctx context.Context, iClient interface{}, path string, olderThan time.Duration, verbose bool) (int, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return 0, err
+	}
+	return c.CleanupMultipartUploads(ctx, path, olderThan, verbose)
+}
+
+// CleanupMultipartUploads aborts the multipart uploads in path that were started more than
+// olderThan ago, and returns the number of aborted uploads. Their parts are deleted
+func (c *S3Client) CleanupMultipartUploads(ctx context.Context, path string, olderThan time.Duration, verbose bool) (int, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return 0, err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+	logger := resolveLogger(nil, verbose)
+	retry := RetryConfig{}
+	cutoff := time.Now().Add(-olderThan)
+
+	var stale []types.MultipartUpload
+	paginator := s3.NewListMultipartUploadsPaginator(c.svc, &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(s3Path),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("could not list multipart uploads in s3://%s/%s: %w", bucket, s3Path, err)
+		}
+		for _, upload := range page.Uploads {
+			if _, ok := relativeS3Key(aws.ToString(upload.Key), s3Path); !ok {
+				continue
+			}
+			if aws.ToTime(upload.Initiated).Before(cutoff) {
+				stale = append(stale, upload)
+			}
+		}
+	}
+
+	aborted := 0
+	var failed []string
+	for _, upload := range stale {
+		key, uploadID := aws.ToString(upload.Key), aws.ToString(upload.UploadId)
+		desc := fmt.Sprintf("abort multipart upload %s of s3://%s/%s", uploadID, bucket, key)
+		err := retry.do(ctx, logger, desc, func() error {
+			_, err := c.svc.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(bucket),
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			// An upload completed or aborted in the meantime is gone already
+			var noSuchUpload *types.NoSuchUpload
+			if errors.As(err, &noSuchUpload) {
+				return nil
+			}
+			return err
+		})
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return aborted, ctxErr
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%s): %v", key, uploadID, err))
+			continue
+		}
+		logger.Infof("Aborted multipart upload %s of s3://%s/%s started at %s", uploadID, bucket, key, aws.ToTime(upload.Initiated))
+		aborted++
+	}
+	if len(failed) != 0 {
+		return aborted, fmt.Errorf("could not abort %d multipart uploads in s3://%s: %s", len(failed), bucket, strings.Join(failed, ", "))
+	}
+
+	return aborted, nil
+}
@@ -0,0 +1,109 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3PresignOptions holds the options of a presigned URL
+type S3PresignOptions struct {
+	// ResponseContentDisposition overrides the Content-Disposition returned by a presigned GET,
+	// such as `attachment; filename="report.csv"`
+	ResponseContentDisposition string
+	// ResponseContentType overrides the Content-Type returned by a presigned GET
+	ResponseContentType string
+	// ContentType is the Content-Type a presigned PUT must be sent with
+	ContentType string
+}
+
+// PresignGetURL returns a URL to download a single file from S3, valid for expiry
+func PresignGetURL(iClient interface{}, path string, expiry time.Duration) (string, error) {
+	return PresignGetURLWithOptions(iClient, path, expiry, S3PresignOptions{})
+}
+
+// PresignGetURLWithOptions returns a URL to download a single file from S3, valid for expiry, using opts
+func PresignGetURLWithOptions(iClient interface{}, path string, expiry time.Duration, opts S3PresignOptions) (string, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return "", err
+	}
+	return c.PresignGetURL(path, expiry, opts)
+}
+
+// PresignGetURL returns a URL to download a single file from S3, valid for expiry, using opts
+func (c *S3Client) PresignGetURL(path string, expiry time.Duration, opts S3PresignOptions) (string, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		return "", err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3Path),
+	}
+	if opts.ResponseContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(opts.ResponseContentDisposition)
+	}
+	if opts.ResponseContentType != "" {
+		input.ResponseContentType = aws.String(opts.ResponseContentType)
+	}
+
+	svc := c.Service()
+	if svc == nil {
+		return "", fmt.Errorf("could not presign download of s3://%s/%s: presigning requires a client to AWS S3, not another S3API", bucket, s3Path)
+	}
+	req, err := s3.NewPresignClient(svc).PresignGetObject(context.Background(), input, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("could not presign download of s3://%s/%s: %w", bucket, s3Path, err)
+	}
+
+	return req.URL, nil
+}
+
+// PresignPutURL returns a URL to upload a single file to S3, valid for expiry
+func PresignPutURL(iClient interface{}, path string, expiry time.Duration) (string, error) {
+	return PresignPutURLWithOptions(iClient, path, expiry, S3PresignOptions{})
+}
+
+// PresignPutURLWithOptions returns a URL to upload a single file to S3, valid for expiry, using opts
+func PresignPutURLWithOptions(iClient interface{}, path string, expiry time.Duration, opts S3PresignOptions) (string, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return "", err
+	}
+	return c.PresignPutURL(path, expiry, opts)
+}
+
+// PresignPutURL returns a URL to upload a single file to S3, valid for expiry, using opts
+func (c *S3Client) PresignPutURL(path string, expiry time.Duration, opts S3PresignOptions) (string, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		return "", err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3Path),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+
+	svc := c.Service()
+	if svc == nil {
+		return "", fmt.Errorf("could not presign upload of s3://%s/%s: presigning requires a client to AWS S3, not another S3API", bucket, s3Path)
+	}
+	req, err := s3.NewPresignClient(svc).PresignPutObject(context.Background(), input, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("could not presign upload of s3://%s/%s: %w", bucket, s3Path, err)
+	}
+
+	return req.URL, nil
+}
@@ -0,0 +1,98 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3RangeDownloadOptions holds the options of the download of a range of a single file from S3
+type S3RangeDownloadOptions struct {
+	// Verbose logs the progress of the download with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Retry controls the attempts made to download the range
+	Retry RetryConfig
+	// SSECustomerKey is the 256-bit key the file was uploaded with using SSE-C encryption,
+	// which S3 does not store. Reading such a file fails without it
+	SSECustomerKey []byte
+}
+
+// DownloadRangeFromS3 downloads the bytes from start to end (inclusive) of a single file from S3.
+// An end past the end of the file downloads up to the end of the file, and a start past it fails
+// with ErrRangeNotSatisfiable
+func DownloadRangeFromS3(ctx context.Context, iClient interface{}, path string, start, end int64, writer io.Writer, verbose bool) error {
+	return DownloadRangeFromS3WithOptions(ctx, iClient, path, start, end, writer, S3RangeDownloadOptions{Verbose: verbose})
+}
+
+// DownloadRangeFromS3WithOptions downloads the bytes from start to end (inclusive) of a single
+// file from S3 using opts. An end past the end of the file downloads up to the end of the file
+func DownloadRangeFromS3WithOptions(ctx context.Context, iClient interface{}, path string, start, end int64, writer io.Writer, opts S3RangeDownloadOptions) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.DownloadRangeWithOptions(ctx, path, start, end, writer, opts)
+}
+
+// DownloadRange downloads the bytes from start to end (inclusive) of a single file from S3.
+// An end past the end of the file downloads up to the end of the file
+func (c *S3Client) DownloadRange(ctx context.Context, path string, start, end int64, writer io.Writer, verbose bool) error {
+	return c.DownloadRangeWithOptions(ctx, path, start, end, writer, S3RangeDownloadOptions{Verbose: verbose})
+}
+
+// DownloadRangeWithOptions downloads the bytes from start to end (inclusive) of a single file
+// from S3 using opts. See DownloadRangeFromS3WithOptions
+func (c *S3Client) DownloadRangeWithOptions(ctx context.Context, path string, start, end int64, writer io.Writer, opts S3RangeDownloadOptions) error {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	if start < 0 || start > end {
+		return fmt.Errorf("invalid range %d-%d", start, end)
+	}
+	if err := validateSSECustomerKey(opts.SSECustomerKey); err != nil {
+		return err
+	}
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		logger.Errorf("validate s3 path error: %s", err)
+		return err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	// A range is downloaded with a single request, written in order
+	sink, ok := writer.(io.WriterAt)
+	if !ok {
+		sink = newWriterWrapper(writer)
+	}
+	counter := &countingWriterAt{w: sink, total: end - start + 1}
+
+	desc := fmt.Sprintf("download bytes %d-%d of s3://%s/%s", start, end, bucket, s3Path)
+	err := opts.Retry.do(ctx, logger, desc, func() error {
+		counter.reset()
+		downloader := manager.NewDownloader(c.svc, func(d *manager.Downloader) {
+			d.Concurrency = 1
+		})
+
+		input := &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(s3Path),
+			Range:  aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		}
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomerHeaders(opts.SSECustomerKey)
+		_, err := downloader.Download(ctx, counter, input)
+		if isS3RangeNotSatisfiable(err) {
+			return fmt.Errorf("%w: range %d-%d starts past the end of s3://%s/%s", ErrRangeNotSatisfiable, start, end, bucket, s3Path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Downloaded bytes %d-%d of s3://%s/%s (%d bytes)", start, end, bucket, s3Path, counter.n)
+	return nil
+}
@@ -0,0 +1,153 @@
+package skbn_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// sseKey is an SSE-C key, with its encoding and the encoding of its MD5 as sent to S3
+var (
+	sseKey       = bytes.Repeat([]byte{'k'}, 32)
+	sseKeyBase64 = base64.StdEncoding.EncodeToString(sseKey)
+	sseKeyMD5    = func() string { sum := md5.Sum(sseKey); return base64.StdEncoding.EncodeToString(sum[:]) }()
+)
+
+// sseRecorder records the SSE-C headers of the GetObject and HeadObject requests, by operation
+type sseRecorder struct {
+	skbn.S3API
+	mu      sync.Mutex
+	headers map[string][]string
+}
+
+func (r *sseRecorder) record(op string, algorithm, key, keyMD5 *string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.headers == nil {
+		r.headers = map[string][]string{}
+	}
+	r.headers[op] = []string{aws.ToString(algorithm), aws.ToString(key), aws.ToString(keyMD5)}
+}
+
+func (r *sseRecorder) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	r.record("GetObject", params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5)
+	return r.S3API.GetObject(ctx, params, optFns...)
+}
+
+func (r *sseRecorder) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	r.record("HeadObject", params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5)
+	return r.S3API.HeadObject(ctx, params, optFns...)
+}
+
+// checkSSEHeaders fails t unless each of ops was sent with the SSE-C headers of sseKey
+func checkSSEHeaders(t *testing.T, r *sseRecorder, ops ...string) {
+	t.Helper()
+	want := []string{"AES256", sseKeyBase64, sseKeyMD5}
+	for _, op := range ops {
+		got := r.headers[op]
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+			t.Errorf("got SSE-C headers %q sent with %s, want %q", got, op, want)
+		}
+	}
+}
+
+func TestDownloadRangeSSECustomerKey(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "file", []byte("0123456789"))
+	api := &sseRecorder{S3API: fake.Service()}
+
+	var w bytes.Buffer
+	err := skbn.DownloadRangeFromS3WithOptions(context.Background(), api, "bucket/file", 2, 5, &w, skbn.S3RangeDownloadOptions{SSECustomerKey: sseKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.String(); got != "2345" {
+		t.Errorf("got %q downloaded, want %q", got, "2345")
+	}
+	checkSSEHeaders(t, api, "GetObject")
+
+	err = skbn.DownloadRangeFromS3WithOptions(context.Background(), api, "bucket/file", 2, 5, &w, skbn.S3RangeDownloadOptions{SSECustomerKey: []byte("short")})
+	if err == nil {
+		t.Error("got no error with a key of 5 bytes")
+	}
+}
+
+// failingGets fails the first failures GetObject requests with a 500 response, and counts them
+type failingGets struct {
+	skbn.S3API
+	failures int
+	gets     int
+}
+
+func (f *failingGets) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.gets++
+	if f.gets <= f.failures {
+		return nil, internalError()
+	}
+	return f.S3API.GetObject(ctx, params, optFns...)
+}
+
+func TestDownloadRangeRetries(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "file", []byte("0123456789"))
+
+	tests := []struct {
+		name     string
+		failures int
+		retry    skbn.RetryConfig
+		wantErr  bool
+		wantGets int
+	}{
+		{"retried", 2, fastRetry, false, 3},
+		{"attempts exhausted", 3, fastRetry, true, 3},
+		{"single attempt", 1, skbn.RetryConfig{MaxAttempts: 1}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &failingGets{S3API: fake.Service(), failures: tt.failures}
+			var w bytes.Buffer
+			err := skbn.DownloadRangeFromS3WithOptions(context.Background(), api, "bucket/file", 2, 5, &w, skbn.S3RangeDownloadOptions{Retry: tt.retry})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want an error: %v", err, tt.wantErr)
+			}
+			if api.gets != tt.wantGets {
+				t.Errorf("got %d GetObject requests, want %d", api.gets, tt.wantGets)
+			}
+			if !tt.wantErr && w.String() != "2345" {
+				t.Errorf("got %q downloaded, want %q", w.String(), "2345")
+			}
+		})
+	}
+}
+
+func TestDownloadRangeNotSatisfiable(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "file", []byte("0123456789"))
+	api := &failingGets{S3API: fake.Service()}
+
+	var w bytes.Buffer
+	err := skbn.DownloadRangeFromS3WithOptions(context.Background(), api, "bucket/file", 10, 20, &w, skbn.S3RangeDownloadOptions{Retry: fastRetry})
+	if !errors.Is(err, skbn.ErrRangeNotSatisfiable) {
+		t.Fatalf("got error %v, want ErrRangeNotSatisfiable", err)
+	}
+	if want := "range 10-20"; !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want it to name the %s", err, want)
+	}
+	if api.gets != 1 {
+		t.Errorf("got %d GetObject requests, want 1 as the range is not retried", api.gets)
+	}
+}
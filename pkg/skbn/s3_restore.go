@@ -0,0 +1,101 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// RestoreFromGlacier starts restoring a single file archived in the GLACIER or DEEP_ARCHIVE
+// storage class, making a copy of it readable for days. tier is Standard, Bulk or Expedited,
+// empty uses Standard. A restore already in progress is not an error
+func RestoreFromGlacier(ctx context.Context, iClient interface{}, path string, days int, tier string) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.RestoreFromGlacier(ctx, path, days, tier)
+}
+
+// RestoreFromGlacier starts restoring a single file archived in the GLACIER or DEEP_ARCHIVE
+// storage class, making a copy of it readable for days. tier is Standard, Bulk or Expedited,
+// empty uses Standard. A restore already in progress is not an error
+func (c *S3Client) RestoreFromGlacier(ctx context.Context, path string, days int, tier string) error {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		return err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+	if days <= 0 {
+		return fmt.Errorf("invalid number of days %d to restore s3://%s/%s", days, bucket, s3Path)
+	}
+	if tier == "" {
+		tier = string(types.TierStandard)
+	}
+	if !contains(types.Tier("").Values(), tier) {
+		return fmt.Errorf("unsupported restore tier %q", tier)
+	}
+
+	_, err := c.svc.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3Path),
+		RestoreRequest: &types.RestoreRequest{
+			Days:                 aws.Int32(int32(days)),
+			GlacierJobParameters: &types.GlacierJobParameters{Tier: types.Tier(tier)},
+		},
+	})
+	if s3ErrorCode(err) == "RestoreAlreadyInProgress" {
+		return nil
+	}
+	if err != nil {
+		if isS3NotFound(err) {
+			return fmt.Errorf("s3://%s/%s: %w", bucket, s3Path, ErrNotFound)
+		}
+		return fmt.Errorf("could not restore s3://%s/%s: %w", bucket, s3Path, err)
+	}
+	return nil
+}
+
+// IsRestoreComplete reports whether a single file can be downloaded: either it is not archived
+// in the GLACIER or DEEP_ARCHIVE storage class, or a restore of it is complete.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func IsRestoreComplete(ctx context.Context, iClient interface{}, path string) (bool, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return false, err
+	}
+	return c.IsRestoreComplete(ctx, path)
+}
+
+// IsRestoreComplete reports whether a single file can be downloaded: either it is not archived
+// in the GLACIER or DEEP_ARCHIVE storage class, or a restore of it is complete.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func (c *S3Client) IsRestoreComplete(ctx context.Context, path string) (bool, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		return false, err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	head, err := headS3Object(ctx, c.svc, bucket, s3Path, "", "", nil)
+	if err != nil {
+		return false, err
+	}
+
+	// The Restore header is `ongoing-request="true"` during a restore, and
+	// `ongoing-request="false", expiry-date="..."` once the copy is readable
+	if restore := aws.ToString(head.Restore); restore != "" {
+		return strings.Contains(restore, `ongoing-request="false"`), nil
+	}
+	return !isArchivedStorageClass(string(head.StorageClass)), nil
+}
+
+// isArchivedStorageClass reports whether files of storageClass must be restored to be read
+func isArchivedStorageClass(storageClass string) bool {
+	sc := types.StorageClass(storageClass)
+	return sc == types.StorageClassGlacier || sc == types.StorageClassDeepArchive
+}
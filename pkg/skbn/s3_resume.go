@@ -0,0 +1,199 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// resumeETagSuffix is appended to the local path of a resumable download to name the file
+// holding the ETag of the downloaded file, until the download completes
+const resumeETagSuffix = ".etag"
+
+// S3ResumableDownloadOptions holds the options of a resumable download of a single file from S3
+type S3ResumableDownloadOptions struct {
+	// Verbose logs the progress of the download with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// SSECustomerKey is the 256-bit key the file was uploaded with using SSE-C encryption,
+	// which S3 does not store. Reading such a file fails without it
+	SSECustomerKey []byte
+}
+
+// DownloadToFileResumable downloads a single file from S3 to localPath. If localPath holds
+// the beginning of the same version of the file from an interrupted download, only the
+// rest of the file is downloaded and appended. If the file changed since, it is downloaded again
+func DownloadToFileResumable(ctx context.Context, iClient interface{}, path, localPath string, verbose bool) error {
+	return DownloadToFileResumableWithOptions(ctx, iClient, path, localPath, S3ResumableDownloadOptions{Verbose: verbose})
+}
+
+// DownloadToFileResumableWithOptions downloads a single file from S3 to localPath using opts,
+// resuming an interrupted download of the same version of the file. See DownloadToFileResumable
+func DownloadToFileResumableWithOptions(ctx context.Context, iClient interface{}, path, localPath string, opts S3ResumableDownloadOptions) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.DownloadToFileResumableWithOptions(ctx, path, localPath, opts)
+}
+
+// DownloadToFileResumable downloads a single file from S3 to localPath. If localPath holds
+// the beginning of the same version of the file from an interrupted download, only the
+// rest of the file is downloaded and appended. If the file changed since, it is downloaded again
+func (c *S3Client) DownloadToFileResumable(ctx context.Context, path, localPath string, verbose bool) error {
+	return c.DownloadToFileResumableWithOptions(ctx, path, localPath, S3ResumableDownloadOptions{Verbose: verbose})
+}
+
+// DownloadToFileResumableWithOptions downloads a single file from S3 to localPath using opts,
+// resuming an interrupted download. See DownloadToFileResumable
+func (c *S3Client) DownloadToFileResumableWithOptions(ctx context.Context, path, localPath string, opts S3ResumableDownloadOptions) error {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	if err := validateSSECustomerKey(opts.SSECustomerKey); err != nil {
+		return err
+	}
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		logger.Errorf("validate s3 path error: %s", err)
+		return err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	f, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := &resumableDownload{
+		svc:      c.svc,
+		bucket:   bucket,
+		key:      s3Path,
+		f:        f,
+		sseKey:   opts.SSECustomerKey,
+		etagPath: localPath + resumeETagSuffix,
+		logger:   logger,
+	}
+	desc := fmt.Sprintf("download file from s3://%s/%s to %s", bucket, s3Path, localPath)
+	err = RetryConfig{}.do(ctx, logger, desc, func() error {
+		return r.resume(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := os.Remove(r.etagPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	logger.Infof("Downloaded file from s3://%s/%s to %s (%d bytes)", bucket, s3Path, localPath, r.size)
+	return nil
+}
+
+// resumableDownload holds the state of a download to a local file across attempts
+type resumableDownload struct {
+	svc      S3API
+	bucket   string
+	key      string
+	f        *os.File
+	sseKey   []byte
+	etagPath string
+	logger   Logger
+
+	etag string
+	size int64
+}
+
+// maxResumeRestarts is the number of times a download is started over within an attempt when
+// the file changes during it, before failing
+const maxResumeRestarts = 3
+
+// resume downloads the part of the file missing from the local file. If the file changes
+// meanwhile, it is downloaded again from the start, up to maxResumeRestarts times
+func (r *resumableDownload) resume(ctx context.Context) error {
+	for restarts := 0; ; restarts++ {
+		err := r.download(ctx)
+		if !isS3PreconditionFailed(err) || restarts == maxResumeRestarts {
+			return err
+		}
+		r.logger.Infof("s3://%s/%s changed during the download, downloading it again", r.bucket, r.key)
+		// The ETag of the file checked next differs from the one recorded, which truncates the local file
+		r.etag = ""
+	}
+}
+
+// download downloads the part of the file missing from the local file, failing with a
+// precondition error if the file changed since it was checked
+func (r *resumableDownload) download(ctx context.Context) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	offset, err := r.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset == r.size {
+		return nil
+	}
+	if offset > 0 {
+		r.logger.Infof("Resuming download of s3://%s/%s at byte %d of %d", r.bucket, r.key, offset, r.size)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:  aws.String(r.bucket),
+		Key:     aws.String(r.key),
+		Range:   aws.String(fmt.Sprintf("bytes=%d-", offset)),
+		IfMatch: aws.String(r.etag),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomerHeaders(r.sseKey)
+	out, err := r.svc.GetObject(ctx, input)
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	_, err = io.Copy(r.f, out.Body)
+	return err
+}
+
+// check fetches the size and ETag of the file. If the ETag differs from the one the
+// local file was downloaded with, the local file is truncated to download it again
+func (r *resumableDownload) check(ctx context.Context) error {
+	head, err := headS3Object(ctx, r.svc, r.bucket, r.key, "", "", r.sseKey)
+	if err != nil {
+		return err
+	}
+	etag := aws.ToString(head.ETag)
+	r.size = aws.ToInt64(head.ContentLength)
+
+	if r.etag == "" {
+		if b, err := os.ReadFile(r.etagPath); err == nil {
+			r.etag = string(b)
+		}
+	}
+	info, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	if etag == r.etag && info.Size() <= r.size {
+		return nil
+	}
+
+	if info.Size() > 0 {
+		r.logger.Infof("s3://%s/%s changed since the download started, downloading it again", r.bucket, r.key)
+	}
+	if err := r.f.Truncate(0); err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.etagPath, []byte(etag), 0644); err != nil {
+		return err
+	}
+	r.etag = etag
+	return nil
+}
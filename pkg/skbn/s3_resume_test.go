@@ -0,0 +1,73 @@
+package skbn_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+func TestDownloadToFileResumableSSECustomerKey(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "file", []byte("0123456789"))
+	api := &sseRecorder{S3API: fake.Service()}
+	localPath := filepath.Join(t.TempDir(), "file")
+
+	err := skbn.DownloadToFileResumableWithOptions(context.Background(), api, "bucket/file", localPath, skbn.S3ResumableDownloadOptions{SSECustomerKey: sseKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(localPath); string(got) != "0123456789" {
+		t.Errorf("got %q downloaded, want %q", got, "0123456789")
+	}
+	checkSSEHeaders(t, api, "HeadObject", "GetObject")
+}
+
+// changingObject overwrites the file with next after the first HeadObject request, so
+// the file changes between the check of a download and its GetObject request
+type changingObject struct {
+	skbn.S3API
+	fake      *skbntest.FakeS3
+	bucket    string
+	key       string
+	next      []byte
+	once      sync.Once
+	getObject int
+}
+
+func (c *changingObject) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	out, err := c.S3API.HeadObject(ctx, params, optFns...)
+	c.once.Do(func() { c.fake.PutObject(c.bucket, c.key, c.next) })
+	return out, err
+}
+
+func (c *changingObject) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.getObject++
+	return c.S3API.GetObject(ctx, params, optFns...)
+}
+
+func TestDownloadToFileResumableFileChanged(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	fake.PutObject("bucket", "file", []byte("0123456789"))
+	next := []byte("the new content of the file")
+	api := &changingObject{S3API: fake.Service(), fake: fake, bucket: "bucket", key: "file", next: next}
+	localPath := filepath.Join(t.TempDir(), "file")
+
+	if err := skbn.DownloadToFileResumable(context.Background(), api, "bucket/file", localPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(localPath); string(got) != string(next) {
+		t.Errorf("got %q downloaded, want the new content %q", got, next)
+	}
+	if api.getObject != 2 {
+		t.Errorf("got %d GetObject requests, want 2", api.getObject)
+	}
+}
@@ -0,0 +1,170 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// S3SelectCSV is the format of comma (or FieldDelimiter) separated values
+	S3SelectCSV = "CSV"
+	// S3SelectJSON is the format of JSON documents or lines
+	S3SelectJSON = "JSON"
+	// S3SelectParquet is the format of Apache Parquet files, only supported as input
+	S3SelectParquet = "Parquet"
+)
+
+// S3SelectSerialization describes the format of the file queried by SelectFromS3, or of its result
+type S3SelectSerialization struct {
+	// Format is S3SelectCSV, S3SelectJSON or, for the input only, S3SelectParquet
+	Format string
+	// FileHeaderInfo tells how the first line of a CSV input is used: USE to refer to the
+	// columns by name in the query, IGNORE to skip it or NONE, the default, to read it as a record
+	FileHeaderInfo string
+	// FieldDelimiter separates the fields of CSV. Empty uses ","
+	FieldDelimiter string
+	// RecordDelimiter separates the records of CSV, or of a JSON output. Empty uses "\n"
+	RecordDelimiter string
+	// JSONType is DOCUMENT for a JSON input holding a single document, or LINES, the default,
+	// for one document per line
+	JSONType string
+	// CompressionType is the compression of a CSV or JSON input: NONE, the default, GZIP or BZIP2
+	CompressionType string
+}
+
+// SelectFromS3 runs the SQL query on a single file of S3 with S3 Select, reading it as input and
+// writing the records matching the query to w as output. Only the result of the query is
+// transferred, the file is filtered by S3. A query such as `SELECT * FROM S3Object s WHERE
+// s.status = 'failed'` refers to the file as S3Object. It returns an error wrapping ErrNotFound
+// if the file does not exist, and an error if the result ends before S3 reports it complete
+func SelectFromS3(ctx context.Context, iClient interface{}, path, query string, input, output S3SelectSerialization, w io.Writer) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.Select(ctx, path, query, input, output, w)
+}
+
+// Select runs the SQL query on a single file of S3 with S3 Select, reading it as input and
+// writing the records matching the query to w as output. See SelectFromS3
+func (c *S3Client) Select(ctx context.Context, path, query string, input, output S3SelectSerialization, w io.Writer) error {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		return err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	inputSerialization, err := input.inputSerialization()
+	if err != nil {
+		return err
+	}
+	outputSerialization, err := output.outputSerialization()
+	if err != nil {
+		return err
+	}
+
+	out, err := c.svc.SelectObjectContent(ctx, &s3.SelectObjectContentInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(s3Path),
+		Expression:          aws.String(query),
+		ExpressionType:      types.ExpressionTypeSql,
+		InputSerialization:  inputSerialization,
+		OutputSerialization: outputSerialization,
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return fmt.Errorf("s3://%s/%s: %w", bucket, s3Path, ErrNotFound)
+		}
+		return fmt.Errorf("could not query s3://%s/%s: %w", bucket, s3Path, err)
+	}
+	stream := out.GetStream()
+	defer stream.Close()
+
+	complete := false
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *types.SelectObjectContentEventStreamMemberRecords:
+			if _, err := w.Write(e.Value.Payload); err != nil {
+				return err
+			}
+		case *types.SelectObjectContentEventStreamMemberEnd:
+			complete = true
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return fmt.Errorf("could not query s3://%s/%s: %w", bucket, s3Path, err)
+	}
+	if !complete {
+		return fmt.Errorf("the result of the query of s3://%s/%s is incomplete", bucket, s3Path)
+	}
+	return nil
+}
+
+// inputSerialization returns the S3 Select input serialization of s
+func (s S3SelectSerialization) inputSerialization() (*types.InputSerialization, error) {
+	if s.CompressionType != "" && !contains(types.CompressionType("").Values(), s.CompressionType) {
+		return nil, fmt.Errorf("unsupported compression type %q", s.CompressionType)
+	}
+	input := &types.InputSerialization{CompressionType: types.CompressionType(s.CompressionType)}
+
+	switch s.Format {
+	case S3SelectCSV:
+		if s.FileHeaderInfo != "" && !contains(types.FileHeaderInfo("").Values(), s.FileHeaderInfo) {
+			return nil, fmt.Errorf("unsupported CSV file header info %q", s.FileHeaderInfo)
+		}
+		input.CSV = &types.CSVInput{
+			FileHeaderInfo:  types.FileHeaderInfo(s.FileHeaderInfo),
+			FieldDelimiter:  stringOrNil(s.FieldDelimiter),
+			RecordDelimiter: stringOrNil(s.RecordDelimiter),
+		}
+	case S3SelectJSON:
+		jsonType := s.JSONType
+		if jsonType == "" {
+			jsonType = string(types.JSONTypeLines)
+		}
+		if !contains(types.JSONType("").Values(), jsonType) {
+			return nil, fmt.Errorf("unsupported JSON type %q", s.JSONType)
+		}
+		input.JSON = &types.JSONInput{Type: types.JSONType(jsonType)}
+	case S3SelectParquet:
+		// Parquet files are compressed by column, and cannot be compressed as a whole
+		if s.CompressionType != "" && s.CompressionType != string(types.CompressionTypeNone) {
+			return nil, fmt.Errorf("unsupported compression type %q for Parquet", s.CompressionType)
+		}
+		input.Parquet = &types.ParquetInput{}
+	default:
+		return nil, fmt.Errorf("unsupported S3 Select input format %q", s.Format)
+	}
+	return input, nil
+}
+
+// outputSerialization returns the S3 Select output serialization of s
+func (s S3SelectSerialization) outputSerialization() (*types.OutputSerialization, error) {
+	switch s.Format {
+	case S3SelectCSV:
+		return &types.OutputSerialization{CSV: &types.CSVOutput{
+			FieldDelimiter:  stringOrNil(s.FieldDelimiter),
+			RecordDelimiter: stringOrNil(s.RecordDelimiter),
+		}}, nil
+	case S3SelectJSON:
+		return &types.OutputSerialization{JSON: &types.JSONOutput{
+			RecordDelimiter: stringOrNil(s.RecordDelimiter),
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported S3 Select output format %q", s.Format)
+	}
+}
+
+// stringOrNil returns a pointer to s, or nil for an empty s to use the default of S3
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
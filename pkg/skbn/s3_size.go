@@ -0,0 +1,97 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3PrefixSizeOptions holds the options of the sum of the sizes of the files under a prefix
+type S3PrefixSizeOptions struct {
+	// List holds the options of the listing of the files. Its Include and Exclude patterns
+	// select the files counted. Its Limit and Sort are ignored
+	List S3ListOptions
+	// StorageClasses only counts the files of these storage classes, such as STANDARD or
+	// GLACIER. Empty counts the files of all storage classes
+	StorageClasses []string
+	// ExcludeStorageClasses does not count the files of these storage classes
+	ExcludeStorageClasses []string
+}
+
+// PrefixSize returns the number of files under prefix in S3 (recursive) and the sum of their
+// sizes in bytes, listing them one page at a time without holding the whole listing in memory
+func PrefixSize(ctx context.Context, iClient interface{}, prefix string) (objectCount int64, totalBytes int64, err error) {
+	return PrefixSizeWithOptions(ctx, iClient, prefix, S3PrefixSizeOptions{})
+}
+
+// PrefixSizeWithOptions returns the number of files under prefix in S3 (recursive) selected by
+// opts and the sum of their sizes in bytes, listing them one page at a time
+func PrefixSizeWithOptions(ctx context.Context, iClient interface{}, prefix string, opts S3PrefixSizeOptions) (objectCount int64, totalBytes int64, err error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return 0, 0, err
+	}
+	return c.PrefixSize(ctx, prefix, opts)
+}
+
+// PrefixSize returns the number of files under prefix in S3 (recursive) selected by opts
+// and the sum of their sizes in bytes. See PrefixSizeWithOptions
+func (c *S3Client) PrefixSize(ctx context.Context, prefix string, opts S3PrefixSizeOptions) (objectCount int64, totalBytes int64, err error) {
+	pSplit := strings.Split(prefix, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return 0, 0, err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+	filter, err := newKeyFilter(opts.List.Include, opts.List.Exclude)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, sc := range append(append([]string(nil), opts.StorageClasses...), opts.ExcludeStorageClasses...) {
+		if !contains(types.ObjectStorageClass("").Values(), sc) {
+			return 0, 0, fmt.Errorf("unsupported storage class %q", sc)
+		}
+	}
+	listOpts := opts.List
+	listOpts.Limit = 0
+
+	start := time.Now()
+	metrics := resolveMetrics(listOpts.Metrics)
+	desc := fmt.Sprintf("sum the sizes of the files in s3://%s/%s", bucket, s3Path)
+	attempts := 0
+	ctx, span := startSpan(ctx, "skbn.PrefixSize", bucket, s3Path)
+	err = listOpts.Retry.doWithMetrics(ctx, NopLogger(), metrics, "list", desc, func() error {
+		attempts++
+		objectCount, totalBytes = 0, 0
+		return listS3Objects(ctx, c.svc, bucket, s3Path, listOpts, func(obj types.Object) bool {
+			relativePath, ok := relativeS3Key(aws.ToString(obj.Key), s3Path)
+			if !ok || !filter.match(relativePath) || !countStorageClass(string(obj.StorageClass), opts) {
+				return true
+			}
+			objectCount++
+			totalBytes += aws.ToInt64(obj.Size)
+			return true
+		})
+	})
+	observe(metrics, "list", 0, time.Since(start), err)
+	endSpan(span, 0, attempts, err)
+	if err != nil {
+		return 0, 0, err
+	}
+	return objectCount, totalBytes, nil
+}
+
+// countStorageClass reports whether the files of storageClass are counted with opts.
+// Files listed without a storage class, as by some S3 compatible stores, are STANDARD
+func countStorageClass(storageClass string, opts S3PrefixSizeOptions) bool {
+	if storageClass == "" {
+		storageClass = string(types.ObjectStorageClassStandard)
+	}
+	if len(opts.StorageClasses) != 0 && !contains(opts.StorageClasses, storageClass) {
+		return false
+	}
+	return !contains(opts.ExcludeStorageClasses, storageClass)
+}
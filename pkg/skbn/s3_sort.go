@@ -0,0 +1,83 @@
+package skbn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// S3SortNatural sorts the files by key, comparing the runs of digits by their numeric
+	// value, so that file2 comes before file10
+	S3SortNatural = "natural"
+	// S3SortNewestFirst sorts the files by modification time, the most recent first
+	S3SortNewestFirst = "newest-first"
+)
+
+// validateListSort returns an error if sortBy is not a supported order of a listing
+func validateListSort(sortBy string) error {
+	switch sortBy {
+	case "", S3SortNatural, S3SortNewestFirst:
+		return nil
+	}
+	return fmt.Errorf("unsupported sort order %q, expected %s or %s", sortBy, S3SortNatural, S3SortNewestFirst)
+}
+
+// sortS3ObjectInfos sorts infos in the order sortBy. Files of the same modification time
+// are sorted by key
+func sortS3ObjectInfos(infos []S3ObjectInfo, sortBy string) {
+	switch sortBy {
+	case S3SortNatural:
+		sort.SliceStable(infos, func(i, j int) bool {
+			return naturalLess(infos[i].Key, infos[j].Key)
+		})
+	case S3SortNewestFirst:
+		sort.SliceStable(infos, func(i, j int) bool {
+			if !infos[i].LastModified.Equal(infos[j].LastModified) {
+				return infos[i].LastModified.After(infos[j].LastModified)
+			}
+			return infos[i].Key < infos[j].Key
+		})
+	}
+}
+
+// naturalLess reports whether a comes before b in natural order: the runs of digits are
+// compared by numeric value, then by number of leading zeros, the rest byte by byte
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			var da, db string
+			da, a = digitRun(a)
+			db, b = digitRun(b)
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			if len(da) != len(db) {
+				return len(da) < len(db)
+			}
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// digitRun splits s after its leading digits
+func digitRun(s string) (digits, rest string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
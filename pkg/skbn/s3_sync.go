@@ -0,0 +1,344 @@
+package skbn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3SyncOptions holds the options of a synchronization of a directory with S3
+type S3SyncOptions struct {
+	// Verbose logs the progress of the synchronization with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Concurrency is the number of files transferred in parallel. Zero uses 10
+	Concurrency int
+	// FollowSymlinks walks the files and directories symbolic links point to.
+	// Symbolic links are skipped if not set
+	FollowSymlinks bool
+	// Checksum compares files of the same size by the MD5 of the local file and the ETag of the
+	// file in S3, instead of by modification time. Files whose ETag is not an MD5, such as
+	// multipart or SSE-KMS files, are still compared by modification time
+	Checksum bool
+	// Mirror deletes the destination files missing from the source, once all the new and
+	// changed files are transferred. Files excluded by the patterns of List are kept
+	Mirror bool
+	// Upload holds the options of the upload of each file. Its Size is set for each file
+	Upload S3UploadOptions
+	// Download holds the options of the download of each file
+	Download S3DownloadOptions
+	// List holds the options of the listing of the files in S3. Its Include and Exclude
+	// patterns also select the local files. Its Limit is ignored
+	List S3ListOptions
+	// Delete holds the options of the deletion of the files in S3 with Mirror
+	Delete S3DeleteOptions
+	// DryRun logs the files that would be transferred and deleted instead of doing it.
+	// The result holds what would be done, each transfer with the size of its file
+	DryRun bool
+}
+
+// SyncResult is the outcome of a synchronization of a directory with S3
+type SyncResult struct {
+	// Transfers are the results of the files that were new or changed
+	Transfers []FileTransferResult
+	// Transferred is the number of files transferred successfully
+	Transferred int
+	// Skipped is the number of files left as they were, because they did not change
+	Skipped int
+	// Deleted is the number of destination files deleted with Mirror
+	Deleted int
+}
+
+func (opts S3SyncOptions) dirOptions() S3DirOptions {
+	return S3DirOptions{
+		Verbose:        opts.Verbose,
+		Logger:         opts.Logger,
+		Concurrency:    opts.Concurrency,
+		FollowSymlinks: opts.FollowSymlinks,
+		Upload:         opts.Upload,
+		Download:       opts.Download,
+	}
+}
+
+// SyncToS3 uploads the files under localDir (recursive) that are missing from toPrefix or
+// differ from their copy in it, using the paths relative to localDir as paths relative to
+// toPrefix. Files are compared by size, then by modification time or checksum
+func SyncToS3(ctx context.Context, iClient interface{}, toPrefix, localDir string, opts S3SyncOptions) (*SyncResult, error) {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	pSplit := strings.Split(toPrefix, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	bucket, prefix := initS3Variables(pSplit)
+	filter, err := newKeyFilter(opts.List.Include, opts.List.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := walkLocalDir(localDir, opts.FollowSymlinks, logger)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := listSyncFiles(ctx, iClient, toPrefix, opts.List)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	var changed []localFile
+	local := make(map[string]bool)
+	for _, f := range files {
+		key := filepath.ToSlash(f.rel)
+		if !filter.match(key) {
+			continue
+		}
+		local[key] = true
+		if info, ok := remote[key]; ok && !fileChanged(f, info, opts.Checksum, info.LastModified.Before(f.modTime)) {
+			logger.Debugf("Skipping %s: unchanged", f.path)
+			result.Skipped++
+			continue
+		}
+		changed = append(changed, f)
+	}
+
+	if opts.DryRun {
+		for _, f := range changed {
+			r := FileTransferResult{LocalPath: f.path, S3Path: joinS3Key(toPrefix, filepath.ToSlash(f.rel)), BytesTransferred: f.size}
+			logger.Infof("Dry run: would upload %s to s3://%s", r.LocalPath, r.S3Path)
+			result.Transfers = append(result.Transfers, r)
+		}
+	} else {
+		result.Transfers = uploadLocalFiles(ctx, iClient, toPrefix, changed, opts.dirOptions(), logger)
+	}
+	result.Transferred = countTransferred(result.Transfers)
+	if err := dirTransferError("upload", result.Transfers, ctx.Err()); err != nil {
+		return result, err
+	}
+	if !opts.Mirror {
+		return result, nil
+	}
+
+	var keys []string
+	for key := range remote {
+		if !local[key] {
+			keys = append(keys, joinS3Key(prefix, key))
+		}
+	}
+	sort.Strings(keys)
+	deleteOpts := opts.Delete
+	deleteOpts.DryRun = deleteOpts.DryRun || opts.DryRun
+	result.Deleted, err = deleteS3Keys(ctx, c.svc, bucket, keys, deleteOpts, logger)
+	return result, err
+}
+
+// SyncFromS3 downloads the files in fromPrefix (recursive) that are missing from localDir or
+// differ from their local copy, using the paths relative to fromPrefix as paths relative to
+// localDir. Files are compared by size, then by modification time or checksum
+func SyncFromS3(ctx context.Context, iClient interface{}, fromPrefix, localDir string, opts S3SyncOptions) (*SyncResult, error) {
+	logger := resolveLogger(opts.Logger, opts.Verbose)
+	filter, err := newKeyFilter(opts.List.Include, opts.List.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := listSyncFiles(ctx, iClient, fromPrefix, opts.List)
+	if err != nil {
+		return nil, err
+	}
+	var files []localFile
+	if _, err := os.Stat(localDir); err == nil {
+		if files, err = walkLocalDir(localDir, opts.FollowSymlinks, logger); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	local := make(map[string]localFile)
+	for _, f := range files {
+		if key := filepath.ToSlash(f.rel); filter.match(key) {
+			local[key] = f
+		}
+	}
+
+	keys := make([]string, 0, len(remote))
+	for key := range remote {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := &SyncResult{}
+	var modTimes []time.Time
+	for _, key := range keys {
+		info := remote[key]
+		f, ok := local[key]
+		if ok && !fileChanged(f, info, opts.Checksum, f.modTime.Before(info.LastModified)) {
+			logger.Debugf("Skipping %s: unchanged", f.path)
+			result.Skipped++
+			continue
+		}
+		localPath := filepath.Join(localDir, filepath.FromSlash(key))
+		r := FileTransferResult{LocalPath: localPath, S3Path: joinS3Key(fromPrefix, key)}
+		if rel, err := filepath.Rel(localDir, localPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			r.Err = fmt.Errorf("key %s is outside of %s", key, localDir)
+		}
+		if opts.DryRun && r.Err == nil {
+			logger.Infof("Dry run: would download s3://%s to %s", r.S3Path, r.LocalPath)
+			r.BytesTransferred = info.Size
+		}
+		result.Transfers = append(result.Transfers, r)
+		modTimes = append(modTimes, info.LastModified)
+	}
+
+	if !opts.DryRun {
+		downloadS3Files(ctx, iClient, result.Transfers, modTimes, opts.dirOptions(), logger)
+	}
+	result.Transferred = countTransferred(result.Transfers)
+	if err := dirTransferError("download", result.Transfers, ctx.Err()); err != nil {
+		return result, err
+	}
+	if !opts.Mirror {
+		return result, nil
+	}
+
+	var failed []string
+	for key, f := range local {
+		if _, ok := remote[key]; ok {
+			continue
+		}
+		if opts.DryRun {
+			logger.Infof("Dry run: would delete %s", f.path)
+			result.Deleted++
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", f.path, err))
+			continue
+		}
+		logger.Infof("Deleted %s", f.path)
+		result.Deleted++
+	}
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return result, fmt.Errorf("could not delete %d files: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return result, nil
+}
+
+// listSyncFiles returns the files in prefix (recursive) by path relative to it,
+// without the folder placeholders
+func listSyncFiles(ctx context.Context, iClient interface{}, prefix string, opts S3ListOptions) (map[string]S3ObjectInfo, error) {
+	opts.Limit = 0
+	infos, err := GetFileInfoFromS3WithOptions(ctx, iClient, prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]S3ObjectInfo, len(infos))
+	for _, info := range infos {
+		// Keys ending with a slash are folder placeholders, not files
+		if info.Key == "" || strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+		files[info.Key] = info
+	}
+	return files, nil
+}
+
+// fileChanged reports whether the local file f and the file info in S3 differ. Files of the same
+// size are compared by checksum if set and possible, otherwise the source is considered changed
+// if newer, as reported by sourceNewer
+func fileChanged(f localFile, info S3ObjectInfo, checksum bool, sourceNewer bool) bool {
+	if f.size != info.Size {
+		return true
+	}
+	if checksum && isMD5ETag(info.ETag) {
+		sum, err := fileMD5(f.path)
+		// A file that cannot be read is transferred to report the error
+		return err != nil || sum != info.ETag
+	}
+	return sourceNewer
+}
+
+// isMD5ETag reports whether etag is the MD5 of the content of its file. ETags of multipart
+// files end with the number of parts, and those of SSE-KMS files are opaque
+func isMD5ETag(etag string) bool {
+	if len(etag) != 32 {
+		return false
+	}
+	_, err := etagChecksum.decode(etag)
+	return err == nil
+}
+
+// fileMD5 returns the MD5 of the file at p, encoded like an ETag
+func fileMD5(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := etagChecksum.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return etagChecksum.encode(h.Sum(nil)), nil
+}
+
+// countTransferred returns the number of results that succeeded
+func countTransferred(results []FileTransferResult) int {
+	n := 0
+	for _, r := range results {
+		if r.Err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// deleteS3Keys deletes keys from bucket in batches and returns the number of deleted files
+func deleteS3Keys(ctx context.Context, svc S3API, bucket string, keys []string, opts S3DeleteOptions, logger Logger) (int, error) {
+	if opts.Logger != nil || opts.Verbose {
+		logger = resolveLogger(opts.Logger, opts.Verbose)
+	}
+	if opts.DryRun {
+		for _, key := range keys {
+			logger.Infof("Dry run: would delete file from s3://%s/%s", bucket, key)
+		}
+		return len(keys), nil
+	}
+
+	deleted := 0
+	var failed []string
+	for start := 0; start < len(keys); start += s3MaxDeleteObjects {
+		end := start + s3MaxDeleteObjects
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			batch = append(batch, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+		n, f, err := deleteS3Batch(ctx, svc, bucket, batch, opts.Retry, logger)
+		deleted += n
+		failed = append(failed, f...)
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if len(failed) != 0 {
+		return deleted, fmt.Errorf("could not delete %d files from s3://%s: %s", len(failed), bucket, strings.Join(failed, ", "))
+	}
+	return deleted, nil
+}
@@ -0,0 +1,83 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// s3MaxTags is the maximum number of tags of an object
+	s3MaxTags = 10
+	// s3MaxTagKeyLength is the maximum length in characters of a tag key
+	s3MaxTagKeyLength = 128
+	// s3MaxTagValueLength is the maximum length in characters of a tag value
+	s3MaxTagValueLength = 256
+)
+
+// GetObjectTags gets the tags of a single file in S3.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func GetObjectTags(ctx context.Context, iClient interface{}, path string) (map[string]string, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.Tags(ctx, path)
+}
+
+// Tags gets the tags of a single file in S3.
+// It returns an error wrapping ErrNotFound if the file does not exist
+func (c *S3Client) Tags(ctx context.Context, path string) (map[string]string, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, true); err != nil {
+		return nil, err
+	}
+	bucket, s3Path := initS3ObjectVariables(pSplit)
+
+	out, err := c.svc.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(s3Path),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, fmt.Errorf("s3://%s/%s: %w", bucket, s3Path, ErrNotFound)
+		}
+		return nil, fmt.Errorf("could not get tags of s3://%s/%s: %w", bucket, s3Path, err)
+	}
+
+	tags := make(map[string]string, len(out.TagSet))
+	for _, tag := range out.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+// validateTags checks tags against the limits of S3
+func validateTags(tags map[string]string) error {
+	if len(tags) > s3MaxTags {
+		return fmt.Errorf("%d tags exceed the maximum of %d", len(tags), s3MaxTags)
+	}
+	for k, v := range tags {
+		if k == "" || utf8.RuneCountInString(k) > s3MaxTagKeyLength {
+			return fmt.Errorf("tag key %q must be between 1 and %d characters", k, s3MaxTagKeyLength)
+		}
+		if utf8.RuneCountInString(v) > s3MaxTagValueLength {
+			return fmt.Errorf("value of tag %q exceeds %d characters", k, s3MaxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// encodeTags returns tags in the URL query format of the Tagging header, such as team=data&env=prod
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
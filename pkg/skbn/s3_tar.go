@@ -0,0 +1,172 @@
+package skbn
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// DownloadPrefixAsTar writes all files in prefix (recursive) to w as a tar archive, compressed
+// with gzip if gzipped is set, using the paths relative to prefix as the names of the entries.
+// Files are streamed one at a time, without staging them on disk. Directory markers, keys
+// ending in "/", become directory entries
+func DownloadPrefixAsTar(ctx context.Context, iClient interface{}, prefix string, w io.Writer, gzipped bool) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.DownloadPrefixAsTar(ctx, prefix, w, gzipped)
+}
+
+// DownloadPrefixAsTar writes all files in prefix (recursive) to w as a tar archive, compressed
+// with gzip if gzipped is set, using the paths relative to prefix as the names of the entries.
+// Files are streamed one at a time, without staging them on disk. Directory markers, keys
+// ending in "/", become directory entries
+func (c *S3Client) DownloadPrefixAsTar(ctx context.Context, prefix string, w io.Writer, gzipped bool) error {
+	pSplit := strings.Split(prefix, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	var writeErr error
+	err := listS3Objects(ctx, c.svc, bucket, s3Path, S3ListOptions{}, func(obj types.Object) bool {
+		key := aws.ToString(obj.Key)
+		name, ok := relativeS3Key(key, s3Path)
+		if !ok || name == "" {
+			return true
+		}
+		if writeErr = c.writeTarEntry(ctx, tw, bucket, obj, name); writeErr != nil {
+			writeErr = fmt.Errorf("could not archive s3://%s/%s: %w", bucket, key, writeErr)
+			return false
+		}
+		return true
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not list s3://%s: %w", prefix, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		return gz.Close()
+	}
+	return nil
+}
+
+// writeTarEntry writes the file obj to tw as the entry name, or a directory entry for a directory marker
+func (c *S3Client) writeTarEntry(ctx context.Context, tw *tar.Writer, bucket string, obj types.Object, name string) error {
+	if strings.HasSuffix(name, "/") {
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name,
+			Mode:     0o755,
+			ModTime:  aws.ToTime(obj.LastModified),
+		})
+	}
+
+	out, err := c.svc.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    obj.Key,
+	})
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	// The size of the response is used, as the file may have changed since it was listed
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0o644,
+		Size:     aws.ToInt64(out.ContentLength),
+		ModTime:  aws.ToTime(out.LastModified),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, out.Body)
+	return err
+}
+
+// UploadTarToS3 uploads the files of the tar archive read from r, compressed with gzip if gzipped
+// is set, to toPrefix, using the names of the entries as paths relative to toPrefix. Directory
+// entries are skipped, as directories are implied by the keys of their files, and so are links.
+// Files are streamed one at a time: those larger than the default MultipartThreshold go part by
+// part and are attempted once, as an archive cannot be read again
+func UploadTarToS3(ctx context.Context, iClient interface{}, toPrefix string, r io.Reader, gzipped bool) error {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return err
+	}
+	return c.UploadTar(ctx, toPrefix, r, gzipped)
+}
+
+// UploadTar uploads the files of the tar archive read from r, compressed with gzip if gzipped
+// is set, to toPrefix, using the names of the entries as paths relative to toPrefix. See UploadTarToS3
+func (c *S3Client) UploadTar(ctx context.Context, toPrefix string, r io.Reader, gzipped bool) error {
+	if err := validateS3Path(strings.Split(toPrefix, "/"), false); err != nil {
+		return err
+	}
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read the archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("entry %s of the archive is outside of s3://%s", header.Name, toPrefix)
+		}
+		toPath := path.Join(toPrefix, name)
+
+		opts := S3UploadOptions{Size: header.Size}
+		var body io.Reader = tr
+		if header.Size <= s3DefaultMultipartThreshold {
+			// Small files are read in memory to retry them
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("could not read entry %s of the archive: %w", header.Name, err)
+			}
+			body = bytes.NewReader(content)
+		}
+		if _, err := c.Upload(ctx, toPath, name, body, opts); err != nil {
+			return fmt.Errorf("could not upload entry %s of the archive: %w", header.Name, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package skbn
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterWrapperAppendOnly(t *testing.T) {
+	var buf bytes.Buffer
+	ww := newWriterWrapper(struct{ *bytes.Buffer }{&buf})
+	if ww.seekable() {
+		t.Fatal("got a seekable wrapper of a buffer")
+	}
+	if _, err := ww.WriteAt([]byte("0123"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ww.WriteAt([]byte("89"), 8); err == nil {
+		t.Error("got no error writing past the next offset")
+	}
+	if _, err := ww.WriteAt([]byte("4567"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "01234567" {
+		t.Errorf("got %q written, want %q", got, "01234567")
+	}
+}
+
+func TestPartSizing(t *testing.T) {
+	const gib, tib = int64(1024 * 1024 * 1024), int64(1024 * 1024 * 1024 * 1024)
+	tests := []struct {
+		name         string
+		opts         S3UploadOptions
+		wantPartSize int64
+		wantParts    int64 // parts of the file, or of the largest file with an unknown size
+	}{
+		{"40GB with the defaults", S3UploadOptions{Size: 40 * gib}, s3MinPartSize, 8192},
+		{"5TB with the defaults", S3UploadOptions{Size: 5 * tib}, 549755814, 10000},
+		{"unknown size", S3UploadOptions{}, s3DefaultStreamPartSize, 10000},
+		{"40GB with fewer parts", S3UploadOptions{Size: 40 * gib, MaxUploadParts: 1000}, 42949673, 1000},
+		{"40GB with a part size", S3UploadOptions{Size: 40 * gib, PartSize: 100 * 1024 * 1024}, 100 * 1024 * 1024, 410},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			partSize, maxUploadParts := tt.opts.partSizing()
+			if partSize != tt.wantPartSize {
+				t.Errorf("got part size %d, want %d", partSize, tt.wantPartSize)
+			}
+			if maxUploadParts != s3MaxUploadParts && tt.opts.MaxUploadParts == 0 {
+				t.Errorf("got %d parts at most, want %d", maxUploadParts, s3MaxUploadParts)
+			}
+			parts := int64(maxUploadParts)
+			if tt.opts.Size > 0 {
+				parts = (tt.opts.Size + partSize - 1) / partSize
+			}
+			if parts != tt.wantParts || parts > int64(maxUploadParts) {
+				t.Errorf("got %d parts, want %d and at most %d", parts, tt.wantParts, maxUploadParts)
+			}
+			if err := tt.opts.checkPartSizing(partSize, maxUploadParts); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRelativeS3Key(t *testing.T) {
+	tests := []struct {
+		key, prefix string
+		want        string
+		wantOK      bool
+	}{
+		{"a/b/x/a/b/y", "a/b", "x/a/b/y", true},
+		{"a/b/x/a/b/y", "a/b/", "x/a/b/y", true},
+		{"data/backup/data/file", "data", "backup/data/file", true},
+		{"data/backup/data/file", "data/", "backup/data/file", true},
+		{"data/backup/data/file", "backup", "", false},
+		{"database/file", "data", "", false},
+		{"database/file", "data/", "", false},
+		{"a/b", "a/b", "", true},
+		{"a/b/", "a/b/", "", true},
+		{"a/b//c", "a/b", "/c", true},
+		{"file", "", "file", true},
+		{"dir/file", "", "dir/file", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix+"+"+tt.key, func(t *testing.T) {
+			got, ok := relativeS3Key(tt.key, tt.prefix)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestInitS3VariablesJoinsWithSlash(t *testing.T) {
+	tests := []struct {
+		split      []string
+		wantBucket string
+		wantKey    string
+	}{
+		{[]string{"bucket", "file.txt"}, "bucket", "file.txt"},
+		{[]string{"bucket", "dir", "sub", "file.txt"}, "bucket", "dir/sub/file.txt"},
+		{[]string{"bucket", "dir", "", "file.txt"}, "bucket", "dir/file.txt"},
+		{[]string{"bucket"}, "bucket", ""},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.split, "+"), func(t *testing.T) {
+			bucket, key := initS3Variables(tt.split)
+			if bucket != tt.wantBucket || key != tt.wantKey {
+				t.Errorf("got %q, %q, want %q, %q", bucket, key, tt.wantBucket, tt.wantKey)
+			}
+			if strings.Contains(key, `\`) {
+				t.Errorf("got key %q with a backslash", key)
+			}
+		})
+	}
+
+	// Local paths use the separator of the OS, the file name appended to a bucket does not
+	fileName, ok := uploadFileName(filepath.Join("dir", "sub", "file.txt"))
+	if !ok || fileName != "file.txt" {
+		t.Errorf("got file name %q, %v of a local path, want %q", fileName, ok, "file.txt")
+	}
+	if _, key := initS3ObjectVariables(append(strings.Split("bucket/dir", "/"), fileName)); key != "dir/file.txt" {
+		t.Errorf("got key %q, want %q", key, "dir/file.txt")
+	}
+}
@@ -0,0 +1,426 @@
+package skbn
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// S3UploadOptions holds the options of a single file upload to S3
+type S3UploadOptions struct {
+	// PartSize is the size in bytes of each part of a multipart upload, and of each
+	// in memory buffer of the uploader. Zero derives it from Size so that the file fits
+	// in MaxUploadParts parts, or uses 16MB when Size is unknown
+	PartSize int64
+	// MultipartThreshold is the largest Size uploaded with a single PutObject request, reading
+	// the content in memory first. Larger files, and content of unknown size, are sent with a
+	// multipart upload unless they fit in a single part. Zero uses 16MB, and at most 5GB is allowed
+	MultipartThreshold int64
+	// MaxUploadParts is the maximum number of parts of a multipart upload. Together with
+	// PartSize it bounds the size of the file. Zero uses the S3 limit of 10000
+	MaxUploadParts int
+	// Concurrency is the number of parts of a multipart upload sent in parallel. More parts in
+	// flight make up for the latency of each request, such as over a slow link, at the cost of
+	// memory: an upload buffers up to PartSize * (Concurrency + 1) bytes. Zero uses 5
+	Concurrency int
+	// LeavePartsOnError keeps the uploaded parts of a failed multipart upload so it can be
+	// resumed manually, instead of aborting it. Left parts are billed until the upload is
+	// completed or aborted, see CleanupMultipartUploads
+	LeavePartsOnError bool
+	// BufferProvider buffers the parts read from a seekable reader that implements
+	// io.ReaderAt, such as an *os.File, while they are sent. A
+	// manager.NewBufferedReadSeekerWriteToPool shared by concurrent uploads reuses the same
+	// buffers across them. Nil uses the default of the uploader, which only buffers on
+	// Windows. Other content, and content sent with Compress or MaxBytesPerSecond, is always
+	// buffered in PartSize parts, up to PartSize * (Concurrency + 1) bytes per upload,
+	// whatever the provider
+	BufferProvider manager.ReadSeekerWriteToProvider
+	// ChecksumAlgorithm is the additional checksum S3 validates the content with and stores
+	// with the file: CRC32, CRC32C, SHA1 or SHA256. Endpoints that do not support additional
+	// checksums, such as older MinIO, ignore it
+	ChecksumAlgorithm string
+	// MaxBytesPerSecond limits the bandwidth of the whole upload, across all its parts.
+	// Zero does not limit it
+	MaxBytesPerSecond int64
+	// Metrics receives the outcome of the upload as operation "upload"
+	Metrics Metrics
+	// Size is the length in bytes of the content, if known. Zero means unknown, unless
+	// the reader is seekable, such as an *os.File or a *bytes.Reader, and measured
+	Size int64
+	// Verbose logs the progress of the upload with the standard logger, unless Logger is set
+	Verbose bool
+	Logger  Logger
+	// Retry controls the attempts made to upload the file
+	Retry RetryConfig
+	// Timeout bounds the whole upload, including all its attempts and the waits between them.
+	// Once exceeded the upload is aborted with an error wrapping context.DeadlineExceeded.
+	// Zero does not limit it
+	Timeout time.Duration
+	// Progress is called as the content is read. The total is Size, or -1 when unknown
+	Progress ProgressFunc
+	// HTTPClient gets the source of UploadFromURLToS3. Nil uses the HTTP client of the client
+	// to S3, with the proxy, TLS and CA settings of its S3Config
+	HTTPClient *http.Client
+
+	// ServerSideEncryption is the encryption algorithm S3 uses to store the file:
+	// AES256 (SSE-S3), aws:kms (SSE-KMS) or aws:kms:dsse. Empty uses the bucket default
+	ServerSideEncryption string
+	// SSEKMSKeyID is the KMS key used with aws:kms encryption. Empty uses the AWS managed key
+	SSEKMSKeyID string
+	// SSEKMSEncryptionContext is the encryption context of aws:kms and aws:kms:dsse encryption,
+	// recorded with each use of the key in CloudTrail. Decrypting the file needs the same context
+	SSEKMSEncryptionContext map[string]string
+	// BucketKeyEnabled encrypts the file with an S3 Bucket Key derived from the KMS key, which
+	// reduces the requests to KMS of aws:kms encryption and their cost
+	BucketKeyEnabled bool
+	// SSECustomerKey encrypts the file with SSE-C, using this 256-bit key provided with each
+	// request instead of ServerSideEncryption. S3 does not store the key, which must be given
+	// again as the SSECustomerKey of the downloads of the file
+	SSECustomerKey []byte
+
+	// StorageClass is the storage class of the file, such as STANDARD_IA or GLACIER.
+	// Empty uses the bucket default
+	StorageClass string
+
+	// ObjectLockMode is the Object Lock retention mode of the file, GOVERNANCE or COMPLIANCE,
+	// until ObjectLockRetainUntilDate. Both are set together. The bucket must have Object
+	// Lock enabled. Files with Object Lock are uploaded with a CRC32 checksum unless
+	// ChecksumAlgorithm is set, as S3 requires one
+	ObjectLockMode            string
+	ObjectLockRetainUntilDate time.Time
+	// ObjectLockLegalHoldStatus is the Object Lock legal hold of the file, ON or OFF.
+	// The bucket must have Object Lock enabled
+	ObjectLockLegalHoldStatus string
+
+	// ACL is the canned ACL of the file, such as bucket-owner-full-control or public-read
+	ACL string
+	// Metadata is the user metadata of the file, stored as x-amz-meta-* headers
+	Metadata map[string]string
+	// Tags are the tags of the file, up to 10
+	Tags map[string]string
+	// ContentDisposition is the Content-Disposition of the file. Empty uses "attachment"
+	ContentDisposition string
+	// ContentType is the Content-Type of the file. Empty detects it from the first 512 bytes
+	// of the content, unless DisableContentTypeDetection is set
+	ContentType string
+	// DisableContentTypeDetection leaves the Content-Type to S3 when ContentType is empty
+	DisableContentTypeDetection bool
+	// ContentEncoding is the Content-Encoding of the file, such as gzip for content that is
+	// already compressed
+	ContentEncoding string
+	// CacheControl is the Cache-Control of the file, such as max-age=86400
+	CacheControl string
+	// Expires is the Expires date of the file. Zero does not set it
+	Expires time.Time
+	// Headers are additional headers sent with the request creating the file, such as
+	// Content-Language or x-amz-website-redirect-location. The headers set by other options
+	// take precedence
+	Headers map[string]string
+	// Compress compresses the content with gzip while uploading it, and sets the Content-Encoding
+	// to gzip. The Content-Type is detected from the content before compression. Size and
+	// the reported progress remain those of the uncompressed content
+	Compress bool
+
+	// OnlyIfAbsent only creates the file if it does not exist yet, with an If-None-Match
+	// conditional write. The upload fails with ErrPreconditionFailed if the file exists
+	OnlyIfAbsent bool
+	// CheckAbsentWithHead makes OnlyIfAbsent check that the file does not exist with a
+	// HeadObject request before uploading, for endpoints not supporting conditional writes.
+	// Unlike a conditional write, this is racy: another writer can still create the file
+	// between the check and the end of the upload
+	CheckAbsentWithHead bool
+
+	// DryRun logs the upload instead of doing it, without reading the content,
+	// and returns an empty result
+	DryRun bool
+}
+
+const (
+	// s3MinPartSize is the smallest part size S3 accepts, except for the last part
+	s3MinPartSize = 5 * 1024 * 1024
+	// s3DefaultStreamPartSize is the part size of uploads of unknown size,
+	// allowing streams of up to 160GB in 10000 parts
+	s3DefaultStreamPartSize = 16 * 1024 * 1024
+	// s3DefaultMultipartThreshold is the largest file uploaded with a single request by default
+	s3DefaultMultipartThreshold = 16 * 1024 * 1024
+	// s3MaxPutObjectSize is the largest file S3 accepts in a single PutObject request
+	s3MaxPutObjectSize = 5 * 1024 * 1024 * 1024
+)
+
+// singlePart reports whether the upload is sent with a single PutObject request
+func (opts S3UploadOptions) singlePart() bool {
+	threshold := opts.MultipartThreshold
+	if threshold <= 0 {
+		threshold = s3DefaultMultipartThreshold
+	}
+	return opts.Size > 0 && opts.Size <= threshold
+}
+
+// partSizing returns the part size and the maximum number of parts of the upload
+func (opts S3UploadOptions) partSizing() (int64, int) {
+	maxUploadParts := opts.MaxUploadParts
+	if maxUploadParts <= 0 {
+		maxUploadParts = s3MaxUploadParts
+	}
+	partSize := opts.PartSize
+	if partSize <= 0 {
+		if opts.Size > 0 {
+			partSize = calculatePartSize(opts.Size, maxUploadParts)
+		} else {
+			partSize = s3DefaultStreamPartSize
+		}
+	}
+	return partSize, maxUploadParts
+}
+
+// checkPartSizing returns an error if partSize * maxUploadParts cannot hold opts.Size
+func (opts S3UploadOptions) checkPartSizing(partSize int64, maxUploadParts int) error {
+	capacity := partSize * int64(maxUploadParts)
+	if opts.Size <= capacity {
+		return nil
+	}
+	return fmt.Errorf("part size %s x %d parts = %s cannot hold %s object; increase part size",
+		formatBytes(partSize), maxUploadParts, formatBytes(capacity), formatBytes(opts.Size))
+}
+
+// validate checks that the options can be combined in a single upload
+func (opts S3UploadOptions) validate() error {
+	if opts.ServerSideEncryption != "" && !contains(types.ServerSideEncryption("").Values(), opts.ServerSideEncryption) {
+		return fmt.Errorf("unsupported server side encryption %q", opts.ServerSideEncryption)
+	}
+	if opts.SSEKMSKeyID != "" && !opts.usesKMS() {
+		return fmt.Errorf("a KMS key id requires %q server side encryption, got %q", types.ServerSideEncryptionAwsKms, opts.ServerSideEncryption)
+	}
+	if len(opts.SSEKMSEncryptionContext) != 0 && !opts.usesKMS() {
+		return fmt.Errorf("a KMS encryption context requires %q server side encryption, got %q", types.ServerSideEncryptionAwsKms, opts.ServerSideEncryption)
+	}
+	if opts.BucketKeyEnabled && types.ServerSideEncryption(opts.ServerSideEncryption) != types.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("a bucket key requires %q server side encryption, got %q", types.ServerSideEncryptionAwsKms, opts.ServerSideEncryption)
+	}
+	if err := validateSSECustomerKey(opts.SSECustomerKey); err != nil {
+		return err
+	}
+	if len(opts.SSECustomerKey) != 0 && opts.ServerSideEncryption != "" {
+		return fmt.Errorf("an SSE-C key cannot be combined with %q server side encryption", opts.ServerSideEncryption)
+	}
+	if opts.StorageClass != "" && !contains(types.StorageClass("").Values(), opts.StorageClass) {
+		return fmt.Errorf("unsupported storage class %q", opts.StorageClass)
+	}
+	if _, ok := s3Checksums[opts.ChecksumAlgorithm]; opts.ChecksumAlgorithm != "" && !ok {
+		return fmt.Errorf("unsupported checksum algorithm %q", opts.ChecksumAlgorithm)
+	}
+	if opts.ObjectLockMode != "" && !contains(types.ObjectLockMode("").Values(), opts.ObjectLockMode) {
+		return fmt.Errorf("unsupported object lock mode %q", opts.ObjectLockMode)
+	}
+	if (opts.ObjectLockMode != "") != !opts.ObjectLockRetainUntilDate.IsZero() {
+		return fmt.Errorf("an object lock mode and retain until date must be set together")
+	}
+	if opts.ObjectLockLegalHoldStatus != "" && !contains(types.ObjectLockLegalHoldStatus("").Values(), opts.ObjectLockLegalHoldStatus) {
+		return fmt.Errorf("unsupported object lock legal hold status %q", opts.ObjectLockLegalHoldStatus)
+	}
+	if opts.ACL != "" && !contains(types.ObjectCannedACL("").Values(), opts.ACL) {
+		return fmt.Errorf("unsupported canned ACL %q", opts.ACL)
+	}
+	if opts.MultipartThreshold > s3MaxPutObjectSize {
+		return fmt.Errorf("a multipart threshold of %s is larger than the %s of a single request", formatBytes(opts.MultipartThreshold), formatBytes(s3MaxPutObjectSize))
+	}
+	if opts.Compress && opts.ContentEncoding != "" && opts.ContentEncoding != contentEncodingGzip {
+		return fmt.Errorf("compressed content cannot have the %q content encoding", opts.ContentEncoding)
+	}
+	if err := validateTags(opts.Tags); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (opts S3UploadOptions) usesObjectLock() bool {
+	return opts.ObjectLockMode != "" || opts.ObjectLockLegalHoldStatus != ""
+}
+
+func (opts S3UploadOptions) usesKMS() bool {
+	sse := types.ServerSideEncryption(opts.ServerSideEncryption)
+	return sse == types.ServerSideEncryptionAwsKms || sse == types.ServerSideEncryptionAwsKmsDsse
+}
+
+// apply sets the options on input
+func (opts S3UploadOptions) apply(input *s3.PutObjectInput) {
+	input.ServerSideEncryption = types.ServerSideEncryption(opts.ServerSideEncryption)
+	if opts.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(opts.SSEKMSKeyID)
+	}
+	if len(opts.SSEKMSEncryptionContext) != 0 {
+		// The context is sent as base64 encoded JSON
+		encryptionContext, _ := json.Marshal(opts.SSEKMSEncryptionContext)
+		input.SSEKMSEncryptionContext = aws.String(base64.StdEncoding.EncodeToString(encryptionContext))
+	}
+	if opts.BucketKeyEnabled {
+		input.BucketKeyEnabled = aws.Bool(true)
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseCustomerHeaders(opts.SSECustomerKey)
+	input.StorageClass = types.StorageClass(opts.StorageClass)
+	input.ChecksumAlgorithm = types.ChecksumAlgorithm(opts.ChecksumAlgorithm)
+	if opts.ObjectLockMode != "" {
+		input.ObjectLockMode = types.ObjectLockMode(opts.ObjectLockMode)
+		input.ObjectLockRetainUntilDate = aws.Time(opts.ObjectLockRetainUntilDate)
+	}
+	input.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatus(opts.ObjectLockLegalHoldStatus)
+	input.ACL = types.ObjectCannedACL(opts.ACL)
+	if len(opts.Metadata) != 0 {
+		input.Metadata = opts.Metadata
+	}
+	if len(opts.Tags) != 0 {
+		input.Tagging = aws.String(encodeTags(opts.Tags))
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if !opts.Expires.IsZero() {
+		input.Expires = aws.Time(opts.Expires)
+	}
+	if opts.Compress {
+		input.ContentEncoding = aws.String(contentEncodingGzip)
+	} else if opts.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+}
+
+// putObject uploads the content of input with a single PutObject request, returning the same
+// output as the uploader. The content is read in memory to send its length, as the request
+// cannot be signed over a stream otherwise
+func (c *S3Client) putObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*manager.UploadOutput, error) {
+	content, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	input.Body = bytes.NewReader(content)
+	input.ContentLength = aws.Int64(int64(len(content)))
+	var location string
+	out, err := c.svc.PutObject(ctx, input, append(optFns, recordLocation(&location))...)
+	if err != nil {
+		return nil, err
+	}
+	return &manager.UploadOutput{
+		Location:  location,
+		Key:       input.Key,
+		ETag:      out.ETag,
+		VersionID: out.VersionId,
+	}, nil
+}
+
+// recordLocation returns the client option storing the URL of the request, without its query, in location
+func recordLocation(location *string) func(*s3.Options) {
+	record := middleware.FinalizeMiddlewareFunc("skbnRecordLocation", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			u := *req.URL
+			u.RawQuery = ""
+			*location = u.String()
+		}
+		return next.HandleFinalize(ctx, in)
+	})
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Finalize.Add(record, middleware.After)
+		})
+	}
+}
+
+// uploadFileName returns the file name of fromPath, used as the key of an upload to a bucket only.
+// It returns false if there is none, such as for a stream read from stdin without a name ("" or "-")
+// or a directory
+func uploadFileName(fromPath string) (string, bool) {
+	_, fileName := path.Split(filepath.ToSlash(fromPath))
+	if fileName == "" || fileName == "." || fileName == ".." || fileName == "-" {
+		return "", false
+	}
+	return fileName, true
+}
+
+// seekableLength returns the offset of r and the length of its content from there,
+// if r is seekable. Seeking fails on readers such as a pipe even if they are *os.File
+func seekableLength(r io.Reader) (offset, length int64, ok bool) {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return 0, 0, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, false
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0, false
+	}
+	return offset, end - offset, true
+}
+
+// headersOption returns the client option sending headers with the requests creating the file of an upload
+func headersOption(headers map[string]string) func(*s3.Options) {
+	return withHeaders("skbnHeaders", headers, "PutObject", "CreateMultipartUpload")
+}
+
+// ifNoneMatch is the client option making the requests creating the file of an upload
+// fail if it already exists. The uploader does not pass the IfNoneMatch of its input
+// on to the completion of a multipart upload
+var ifNoneMatch = withHeaders("skbnIfNoneMatch", map[string]string{"If-None-Match": "*"}, "PutObject", "CompleteMultipartUpload")
+
+// withHeaders returns the client option sending headers with the requests of operations.
+// id names the middleware setting them, and must differ between the options of a client
+func withHeaders(id string, headers map[string]string, operations ...string) func(*s3.Options) {
+	set := middleware.BuildMiddlewareFunc(id, func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok && contains(operations, middleware.GetOperationName(ctx)) {
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+		}
+		return next.HandleBuild(ctx, in)
+	})
+	return func(o *s3.Options) {
+		o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Build.Add(set, middleware.After)
+		})
+	}
+}
+
+func contains[T ~string](list []T, s string) bool {
+	for _, v := range list {
+		if string(v) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBytes returns n in a human readable unit, such as 5MB or 1.5GB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + string("KMGTP"[exp]) + "B"
+}
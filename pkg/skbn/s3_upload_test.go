@@ -0,0 +1,264 @@
+package skbn_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// fastRetry retries without waiting long between attempts
+var fastRetry = skbn.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+// failingPuts fails the first failures PutObject requests with a 500 response,
+// after reading their whole body like a request failing on its response would
+type failingPuts struct {
+	skbn.S3API
+	failures int
+	puts     int
+}
+
+func (f *failingPuts) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.puts++
+	if f.puts <= f.failures {
+		io.Copy(io.Discard, params.Body)
+		return nil, internalError()
+	}
+	return f.S3API.PutObject(ctx, params, optFns...)
+}
+
+// internalError returns the error of a request S3 answered with a 500 response
+func internalError() error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusInternalServerError}},
+		Err:      errors.New("internal error"),
+	}}
+}
+
+// stream hides the methods of r other than Read, like a pipe
+type stream struct {
+	io.Reader
+}
+
+func TestUploadRetries(t *testing.T) {
+	content := []byte("the whole content of the file")
+	tests := []struct {
+		name     string
+		reader   io.Reader
+		failures int
+		wantErr  bool
+		wantPuts int
+	}{
+		{"seekable reader rewound", bytes.NewReader(content), 1, false, 2},
+		{"stream succeeding", stream{bytes.NewReader(content)}, 0, false, 1},
+		{"stream not attempted again", stream{bytes.NewReader(content)}, 1, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := skbntest.NewFakeS3("bucket")
+			defer fake.Close()
+			api := &failingPuts{S3API: fake.Service(), failures: tt.failures}
+
+			_, err := skbn.UploadToS3WithOptions(context.Background(), api, "bucket/file", "", tt.reader, skbn.S3UploadOptions{Retry: fastRetry})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if api.puts != tt.wantPuts {
+				t.Errorf("got %d PutObject requests, want %d", api.puts, tt.wantPuts)
+			}
+			got, ok := fake.Object("bucket", "file")
+			if tt.wantErr {
+				if ok {
+					t.Errorf("got file %q after a failed upload, want none", got)
+				}
+				return
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("got content %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestUploadUnknownLengthStream(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+
+	// Larger than a part, so that it is sent with a multipart upload
+	content := bytes.Repeat([]byte("0123456789abcdef"), 12*1024*1024/16)
+	pr, pw := io.Pipe()
+	go func() {
+		for b := content; len(b) > 0; b = b[min(len(b), 100000):] {
+			pw.Write(b[:min(len(b), 100000)])
+		}
+		pw.Close()
+	}()
+
+	result, err := skbn.UploadToS3WithOptions(context.Background(), fake.Client(), "bucket/stream", "", pr, skbn.S3UploadOptions{PartSize: 5 * 1024 * 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.BytesTransferred != int64(len(content)) {
+		t.Errorf("got %d bytes transferred, want %d", result.BytesTransferred, len(content))
+	}
+	got, _ := fake.Object("bucket", "stream")
+	if !bytes.Equal(got, content) {
+		t.Errorf("got %d bytes uploaded, want the %d bytes of the stream", len(got), len(content))
+	}
+}
+
+func TestUploadSendsContentLength(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	target, _ := url.Parse(fake.URL())
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	// Some S3 compatible endpoints reject the uploads without a Content-Length
+	strict := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.ContentLength < 0 {
+			http.Error(w, "<Error><Code>MissingContentLength</Code></Error>", http.StatusLengthRequired)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer strict.Close()
+	svc := s3.New(s3.Options{
+		Region:                     "us-east-1",
+		BaseEndpoint:               aws.String(strict.URL),
+		UsePathStyle:               true,
+		Credentials:                credentials.NewStaticCredentialsProvider("skbntest", "skbntest", ""),
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+	})
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"single request", 1024},
+		{"multipart", 12 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := bytes.Repeat([]byte{'x'}, tt.size)
+			_, err := skbn.UploadToS3WithOptions(context.Background(), svc, "bucket/"+tt.name, "", bytes.NewReader(content), skbn.S3UploadOptions{PartSize: 5 * 1024 * 1024, MultipartThreshold: 5 * 1024 * 1024})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := fake.Object("bucket", tt.name); !bytes.Equal(got, content) {
+				t.Errorf("got %d bytes uploaded, want %d", len(got), len(content))
+			}
+		})
+	}
+}
+
+// countingProvider counts the parts buffered by a manager.ReadSeekerWriteToProvider
+type countingProvider struct {
+	manager.ReadSeekerWriteToProvider
+	parts atomic.Int32
+}
+
+func (p *countingProvider) GetWriteTo(seeker io.ReadSeeker) (manager.ReadSeekerWriteTo, func()) {
+	p.parts.Add(1)
+	return p.ReadSeekerWriteToProvider.GetWriteTo(seeker)
+}
+
+func TestUploadBufferProvider(t *testing.T) {
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+	content := bytes.Repeat([]byte("0123456789"), 1200*1024)
+	tests := []struct {
+		name      string
+		opts      skbn.S3UploadOptions
+		wantParts int32
+	}{
+		{"seekable", skbn.S3UploadOptions{}, 3},
+		{"throttled", skbn.S3UploadOptions{MaxBytesPerSecond: 1 << 30}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &countingProvider{ReadSeekerWriteToProvider: manager.NewBufferedReadSeekerWriteToPool(1024 * 1024)}
+			opts := tt.opts
+			opts.PartSize, opts.MultipartThreshold = 5*1024*1024, 5*1024*1024
+			opts.BufferProvider = provider
+			var lastProgress int64
+			opts.Progress = func(bytesSoFar, totalBytes int64) { atomic.StoreInt64(&lastProgress, bytesSoFar) }
+			// The reader starts past its first byte, which is not uploaded
+			reader := bytes.NewReader(append([]byte{'-'}, content...))
+			reader.Seek(1, io.SeekStart)
+
+			result, err := skbn.UploadToS3WithOptions(context.Background(), fake.Service(), "bucket/"+tt.name, "", reader, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := provider.parts.Load(); got != tt.wantParts {
+				t.Errorf("got %d parts buffered by the provider, want %d", got, tt.wantParts)
+			}
+			if result.BytesTransferred != int64(len(content)) || atomic.LoadInt64(&lastProgress) != int64(len(content)) {
+				t.Errorf("got %d bytes transferred and %d reported, want %d", result.BytesTransferred, lastProgress, len(content))
+			}
+			if got, _ := fake.Object("bucket", tt.name); !bytes.Equal(got, content) {
+				t.Errorf("got %d bytes uploaded, want the %d bytes after the offset", len(got), len(content))
+			}
+		})
+	}
+}
+
+func TestUploadToBucketOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		toPath   string
+		fromPath string
+		wantKey  string
+	}{
+		{"file name", "bucket", "/tmp/dir/file.txt", "file.txt"},
+		{"file name with a trailing slash", "bucket/", "dir/file.txt", "file.txt"},
+		{"no file name", "bucket", "", ""},
+		{"no file name with a trailing slash", "bucket/", "", ""},
+		{"stdin", "bucket/", "-", ""},
+		{"directory", "bucket", "dir/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := skbntest.NewFakeS3("bucket")
+			defer fake.Close()
+
+			result, err := skbn.UploadToS3WithOptions(context.Background(), fake.Service(), tt.toPath, tt.fromPath, strings.NewReader("content"), skbn.S3UploadOptions{})
+			if tt.wantKey == "" {
+				if err == nil {
+					t.Errorf("got file %q uploaded, want an error", result.Key)
+				}
+				if keys := fake.Keys("bucket"); len(keys) != 0 {
+					t.Errorf("got keys %q, want none", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Key != tt.wantKey {
+				t.Errorf("got key %q, want %q", result.Key, tt.wantKey)
+			}
+			if _, ok := fake.Object("bucket", tt.wantKey); !ok {
+				t.Errorf("got no file %q", tt.wantKey)
+			}
+		})
+	}
+}
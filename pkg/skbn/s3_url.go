@@ -0,0 +1,77 @@
+package skbn
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// UploadFromURLToS3 uploads the content of sourceURL to toPath, streaming the response to a
+// GET request, such as of a presigned URL, to S3 without staging it locally. A toPath of a
+// bucket only uploads to the file name of the path of sourceURL. The Content-Type and
+// Content-Length of the response are used unless opts sets ContentType or Size. A response
+// other than 200 OK is returned as an error with its status. The response cannot be read
+// again, so the upload is attempted once, whatever opts.Retry. The request is sent with
+// opts.HTTPClient, else with the HTTP client of iClient, and opts.Timeout bounds both the
+// request and the upload
+func UploadFromURLToS3(ctx context.Context, iClient interface{}, toPath, sourceURL string, opts S3UploadOptions) (UploadResult, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return UploadResult{}, err
+	}
+	return c.UploadFromURL(ctx, toPath, sourceURL, opts)
+}
+
+// UploadFromURL uploads the content of sourceURL to toPath, streaming the response to a
+// GET request to S3 without staging it locally. See UploadFromURLToS3
+func (c *S3Client) UploadFromURL(ctx context.Context, toPath, sourceURL string, opts S3UploadOptions) (UploadResult, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("invalid source URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return UploadResult{}, fmt.Errorf("unsupported scheme %q of source URL, expected http or https", u.Scheme)
+	}
+	// The query of a presigned URL holds its signature, which is left out of errors and logs
+	source := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+
+	opCtx, cancel := withTimeout(ctx, opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(opCtx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("could not request %s: %w", source, err)
+	}
+	resp, err := c.sourceHTTPClient(opts).Do(req)
+	if err != nil {
+		return UploadResult{}, timeoutError(ctx, opCtx, opts.Timeout, fmt.Errorf("could not get %s: %w", source, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return UploadResult{}, fmt.Errorf("could not get %s: %s", source, resp.Status)
+	}
+
+	if opts.ContentType == "" {
+		opts.ContentType = resp.Header.Get("Content-Type")
+	}
+	if opts.Size <= 0 && resp.ContentLength > 0 {
+		opts.Size = resp.ContentLength
+	}
+	result, err := c.upload(opCtx, toPath, u.Path, resp.Body, opts)
+	return result, timeoutError(ctx, opCtx, opts.Timeout, err)
+}
+
+// sourceHTTPClient returns the client getting the source of an upload from a URL: opts.HTTPClient,
+// else the HTTP client of the service built by newHTTPClient, else the default client of the SDK
+func (c *S3Client) sourceHTTPClient(opts S3UploadOptions) aws.HTTPClient {
+	if opts.HTTPClient != nil {
+		return opts.HTTPClient
+	}
+	if svc := c.Service(); svc != nil && svc.Options().HTTPClient != nil {
+		return svc.Options().HTTPClient
+	}
+	return awshttp.NewBuildableClient()
+}
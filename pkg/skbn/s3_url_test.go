@@ -0,0 +1,103 @@
+package skbn_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+	"github.com/unfernandito/skbn/pkg/skbn/skbntest"
+)
+
+// countingTransport counts the requests sent to the host of a source URL
+type countingTransport struct {
+	host     string
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Host == t.host {
+		t.requests.Add(1)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestUploadFromURLHTTPClient(t *testing.T) {
+	content := []byte("content of the source")
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer source.Close()
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+
+	tests := []struct {
+		name   string
+		client func(t *testing.T, transport http.RoundTripper) *skbn.S3Client
+		opts   func(transport http.RoundTripper) skbn.S3UploadOptions
+	}{
+		{
+			"options",
+			func(t *testing.T, transport http.RoundTripper) *skbn.S3Client { return fake.Client() },
+			func(transport http.RoundTripper) skbn.S3UploadOptions {
+				return skbn.S3UploadOptions{HTTPClient: &http.Client{Transport: transport}}
+			},
+		},
+		{
+			"client to S3",
+			func(t *testing.T, transport http.RoundTripper) *skbn.S3Client {
+				setTestEnv(t)
+				c, err := skbn.NewS3Client(context.Background(), "bucket", skbn.S3Config{
+					Region:         "us-east-1",
+					Endpoint:       fake.URL(),
+					ForcePathStyle: true,
+					HTTPClient:     &http.Client{Transport: transport},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			},
+			func(transport http.RoundTripper) skbn.S3UploadOptions { return skbn.S3UploadOptions{} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &countingTransport{host: source.Listener.Addr().String()}
+			c := tt.client(t, transport)
+			if _, err := c.UploadFromURL(context.Background(), "bucket/"+tt.name, source.URL+"/file", tt.opts(transport)); err != nil {
+				t.Fatal(err)
+			}
+			if n := transport.requests.Load(); n != 1 {
+				t.Errorf("the source was requested %d times with the HTTP client, want 1", n)
+			}
+			if got, _ := fake.Object("bucket", tt.name); string(got) != string(content) {
+				t.Errorf("got %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestUploadFromURLTimeout(t *testing.T) {
+	done := make(chan struct{})
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer source.Close()
+	defer close(done)
+	fake := skbntest.NewFakeS3("bucket")
+	defer fake.Close()
+
+	_, err := fake.Client().UploadFromURL(context.Background(), "bucket/file", source.URL+"/file",
+		skbn.S3UploadOptions{Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+}
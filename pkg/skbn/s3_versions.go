@@ -0,0 +1,84 @@
+package skbn
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3ObjectVersion holds a version or a delete marker of an object listed from a versioned bucket
+type S3ObjectVersion struct {
+	// Key is the object key relative to the listed path
+	Key       string
+	VersionID string
+	// IsLatest is set for the current version of the object
+	IsLatest bool
+	// IsDeleteMarker is set for delete markers, which have no size or ETag
+	IsDeleteMarker bool
+	Size           int64
+	LastModified   time.Time
+	// ETag is the entity tag of the version, without surrounding quotes
+	ETag string
+}
+
+// ListObjectVersionsFromS3 gets the versions and delete markers of the files in path from S3 (recursive)
+func ListObjectVersionsFromS3(ctx context.Context, iClient interface{}, path string) ([]S3ObjectVersion, error) {
+	c, err := s3ClientFrom(iClient)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListVersions(ctx, path)
+}
+
+// ListVersions gets the versions and delete markers of the files in path from S3 (recursive)
+func (c *S3Client) ListVersions(ctx context.Context, path string) ([]S3ObjectVersion, error) {
+	pSplit := strings.Split(path, "/")
+	if err := validateS3Path(pSplit, false); err != nil {
+		return nil, err
+	}
+	bucket, s3Path := initS3Variables(pSplit)
+
+	var versions []S3ObjectVersion
+	paginator := s3.NewListObjectVersionsPaginator(c.svc, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(s3Path),
+	})
+	for paginator.HasMorePages() {
+		p, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range p.Versions {
+			relativePath, ok := relativeS3Key(aws.ToString(v.Key), s3Path)
+			if !ok {
+				continue
+			}
+			versions = append(versions, S3ObjectVersion{
+				Key:          relativePath,
+				VersionID:    aws.ToString(v.VersionId),
+				IsLatest:     aws.ToBool(v.IsLatest),
+				Size:         aws.ToInt64(v.Size),
+				LastModified: aws.ToTime(v.LastModified),
+				ETag:         strings.Trim(aws.ToString(v.ETag), `"`),
+			})
+		}
+		for _, m := range p.DeleteMarkers {
+			relativePath, ok := relativeS3Key(aws.ToString(m.Key), s3Path)
+			if !ok {
+				continue
+			}
+			versions = append(versions, S3ObjectVersion{
+				Key:            relativePath,
+				VersionID:      aws.ToString(m.VersionId),
+				IsLatest:       aws.ToBool(m.IsLatest),
+				IsDeleteMarker: true,
+				LastModified:   aws.ToTime(m.LastModified),
+			})
+		}
+	}
+
+	return versions, nil
+}
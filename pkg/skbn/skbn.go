@@ -6,7 +6,7 @@ import (
 	"io"
 	"log"
 	"math"
-	"path/filepath"
+	"path"
 
 	"github.com/unfernandito/skbn/pkg/utils"
 
@@ -52,7 +52,7 @@ func TestImplementationsExist(srcPrefix, dstPrefix string) error {
 	case "s3":
 	case "abs":
 	default:
-		return fmt.Errorf(srcPrefix + " not implemented")
+		return fmt.Errorf("%s not implemented", srcPrefix)
 	}
 
 	switch dstPrefix {
@@ -60,7 +60,7 @@ func TestImplementationsExist(srcPrefix, dstPrefix string) error {
 	case "s3":
 	case "abs":
 	default:
-		return fmt.Errorf(dstPrefix + " not implemented")
+		return fmt.Errorf("%s not implemented", dstPrefix)
 	}
 
 	return nil
@@ -92,8 +92,8 @@ func GetFromToPaths(srcClient interface{}, srcPrefix, srcPath, dstPath string) (
 
 	var fromToPaths []FromToPair
 	for _, relativePath := range relativePaths {
-		fromPath := filepath.Join(srcPath, relativePath)
-		toPath := filepath.Join(dstPath, relativePath)
+		fromPath := path.Join(srcPath, relativePath)
+		toPath := path.Join(dstPath, relativePath)
 		fromToPaths = append(fromToPaths, FromToPair{FromPath: fromPath, ToPath: toPath})
 	}
 
@@ -192,7 +192,7 @@ func GetListOfFiles(client interface{}, prefix, path string) ([]string, error) {
 		}
 		relativePaths = paths
 	case "s3":
-		paths, err := GetListOfFilesFromS3(client, path)
+		paths, err := GetListOfFilesFromS3(ctx, client, path)
 		if err != nil {
 			return nil, err
 		}
@@ -204,7 +204,7 @@ func GetListOfFiles(client interface{}, prefix, path string) ([]string, error) {
 		}
 		relativePaths = paths
 	default:
-		return nil, fmt.Errorf(prefix + " not implemented")
+		return nil, fmt.Errorf("%s not implemented", prefix)
 	}
 
 	return relativePaths, nil
@@ -222,7 +222,7 @@ func Download(srcClient interface{}, srcPrefix, srcPath string, writer io.Writer
 			return err
 		}
 	case "s3":
-		err := DownloadFromS3(srcClient, srcPath, writer, verbose)
+		err := DownloadFromS3(ctx, srcClient, srcPath, writer, verbose)
 		if err != nil {
 			return err
 		}
@@ -232,7 +232,7 @@ func Download(srcClient interface{}, srcPrefix, srcPath string, writer io.Writer
 			return err
 		}
 	default:
-		return fmt.Errorf(srcPrefix + " not implemented")
+		return fmt.Errorf("%s not implemented", srcPrefix)
 	}
 
 	return nil
@@ -250,7 +250,7 @@ func Upload(dstClient interface{}, dstPrefix, dstPath, srcPath string, reader io
 			return err
 		}
 	case "s3":
-		err := UploadToS3(dstClient, dstPath, srcPath, reader, s3partSize, s3maxUploadParts, verbose)
+		err := UploadToS3(ctx, dstClient, dstPath, srcPath, reader, s3partSize, s3maxUploadParts, verbose)
 		if err != nil {
 			return err
 		}
@@ -260,7 +260,7 @@ func Upload(dstClient interface{}, dstPrefix, dstPath, srcPath string, reader io
 			return err
 		}
 	default:
-		return fmt.Errorf(dstPrefix + " not implemented")
+		return fmt.Errorf("%s not implemented", dstPrefix)
 	}
 	return nil
 }
@@ -284,7 +284,7 @@ func initClient(ctx context.Context, existingClient interface{}, prefix, path, t
 			newClient = existingClient
 			break
 		}
-		client, err := GetClientToS3(path)
+		client, err := NewS3Client(ctx, path, S3Config{})
 		if err != nil {
 			return nil, "", err
 		}
@@ -302,7 +302,7 @@ func initClient(ctx context.Context, existingClient interface{}, prefix, path, t
 		newClient = client
 
 	default:
-		return nil, "", fmt.Errorf(prefix + " not implemented")
+		return nil, "", fmt.Errorf("%s not implemented", prefix)
 	}
 
 	return newClient, prefix, nil
@@ -0,0 +1,818 @@
+// Package skbntest provides an in-memory fake of S3 to test code using skbn without AWS
+package skbntest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/unfernandito/skbn/pkg/skbn"
+)
+
+// FakeS3 is an S3 compatible server keeping its buckets in memory, for tests. It serves the
+// requests skbn makes to transfer, list and delete files: the bucket head, ListObjects and
+// ListObjectsV2, the get, head, put, copy and deletion of objects, batch deletions and
+// multipart uploads. Other requests fail with a NotImplemented error. Objects are not versioned
+type FakeS3 struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*fakeObject
+	uploads map[string]*fakeUpload
+	nextID  int
+}
+
+// fakeObject is an object stored by FakeS3
+type fakeObject struct {
+	data         []byte
+	etag         string
+	contentType  string
+	metadata     http.Header
+	lastModified time.Time
+	// partSizes are the sizes of the parts of an object created by a multipart upload
+	partSizes []int
+}
+
+// fakeUpload is a multipart upload in progress on FakeS3
+type fakeUpload struct {
+	bucket, key string
+	contentType string
+	metadata    http.Header
+	parts       map[int]*fakeObject
+}
+
+// NewFakeS3 starts a FakeS3 with the given empty buckets. Close it once done
+func NewFakeS3(buckets ...string) *FakeS3 {
+	f := &FakeS3{
+		buckets: make(map[string]map[string]*fakeObject),
+		uploads: make(map[string]*fakeUpload),
+	}
+	for _, bucket := range buckets {
+		f.CreateBucket(bucket)
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// Close stops the server of f
+func (f *FakeS3) Close() {
+	f.server.Close()
+}
+
+// URL is the endpoint of f, to use as the Endpoint of a skbn.S3Config with ForcePathStyle
+func (f *FakeS3) URL() string {
+	return f.server.URL
+}
+
+// Service returns an AWS S3 client to f, with static credentials
+func (f *FakeS3) Service() *s3.Client {
+	return s3.New(s3.Options{
+		Region:                     "us-east-1",
+		BaseEndpoint:               aws.String(f.server.URL),
+		UsePathStyle:               true,
+		Credentials:                credentials.NewStaticCredentialsProvider("skbntest", "skbntest", ""),
+		RequestChecksumCalculation: aws.RequestChecksumCalculationWhenRequired,
+		ResponseChecksumValidation: aws.ResponseChecksumValidationWhenRequired,
+		HTTPClient:                 f.server.Client(),
+	})
+}
+
+// Client returns a skbn client to f, to pass as the iClient of the functions of skbn
+func (f *FakeS3) Client() *skbn.S3Client {
+	return skbn.NewS3ClientFromService(f.Service())
+}
+
+// CreateBucket creates the empty bucket, if it does not exist yet
+func (f *FakeS3) CreateBucket(bucket string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.buckets[bucket] == nil {
+		f.buckets[bucket] = make(map[string]*fakeObject)
+	}
+}
+
+// PutObject stores data as the object key of bucket, creating the bucket if needed
+func (f *FakeS3) PutObject(bucket, key string, data []byte) {
+	f.CreateBucket(bucket)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[bucket][key] = newFakeObject(data, "", nil)
+}
+
+// Object returns the content of the object key of bucket, and whether it exists
+func (f *FakeS3) Object(bucket, key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(obj.data), true
+}
+
+// Keys returns the sorted keys of the objects of bucket
+func (f *FakeS3) Keys(bucket string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return sortedKeys(f.buckets[bucket])
+}
+
+func newFakeObject(data []byte, contentType string, metadata http.Header) *fakeObject {
+	sum := md5.Sum(data)
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	return &fakeObject{
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		contentType:  contentType,
+		metadata:     metadata,
+		lastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// fakeError is an S3 error response
+type fakeError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *fakeError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func (f *FakeS3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key := splitPath(r.URL)
+	var err error
+	if key == "" {
+		err = f.serveBucket(w, r, bucket)
+	} else {
+		err = f.serveObject(w, r, bucket, key)
+	}
+	if err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// splitPath returns the bucket and the key of a path style URL
+func splitPath(u *url.URL) (string, string) {
+	p, err := url.PathUnescape(u.EscapedPath())
+	if err != nil {
+		p = u.Path
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	return bucket, key
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e, ok := err.(*fakeError)
+	if !ok {
+		e = &fakeError{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+	// Responses to HEAD requests have no body, the SDK relies on the status code
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: e.code, Message: e.message})
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func errNoSuchBucket(bucket string) error {
+	return &fakeError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist: " + bucket}
+}
+
+func errNoSuchKey(key string) error {
+	return &fakeError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist: " + key}
+}
+
+func errNotImplemented(r *http.Request) error {
+	return &fakeError{http.StatusNotImplemented, "NotImplemented", fmt.Sprintf("%s %s is not implemented by skbntest", r.Method, r.URL.RequestURI())}
+}
+
+func (f *FakeS3) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodHead:
+		if !f.bucketExists(bucket) {
+			return errNoSuchBucket(bucket)
+		}
+		w.Header().Set("X-Amz-Bucket-Region", "us-east-1")
+		return nil
+	case r.Method == http.MethodGet && query.Has("location"):
+		if !f.bucketExists(bucket) {
+			return errNoSuchBucket(bucket)
+		}
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+		}{})
+		return nil
+	case r.Method == http.MethodGet:
+		return f.list(w, bucket, query)
+	case r.Method == http.MethodPost && query.Has("delete"):
+		return f.deleteObjects(w, r, bucket)
+	default:
+		return errNotImplemented(r)
+	}
+}
+
+func (f *FakeS3) bucketExists(bucket string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buckets[bucket] != nil
+}
+
+func sortedKeys(objects map[string]*fakeObject) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type listContent struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+type listPrefix struct {
+	Prefix string
+}
+
+type listResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	MaxKeys               int
+	KeyCount              int    `xml:",omitempty"`
+	Marker                string `xml:",omitempty"`
+	NextMarker            string `xml:",omitempty"`
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	IsTruncated           bool
+	Contents              []listContent
+	CommonPrefixes        []listPrefix
+}
+
+// list serves ListObjects and, with list-type=2, ListObjectsV2
+func (f *FakeS3) list(w http.ResponseWriter, bucket string, query url.Values) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objects := f.buckets[bucket]
+	if objects == nil {
+		return errNoSuchBucket(bucket)
+	}
+
+	v2 := query.Get("list-type") == "2"
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	maxKeys := 1000
+	if n, err := strconv.Atoi(query.Get("max-keys")); err == nil && n >= 0 && n < maxKeys {
+		maxKeys = n
+	}
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			after = token
+		}
+	}
+
+	result := listResult{Name: bucket, Prefix: prefix, Delimiter: delimiter, MaxKeys: maxKeys}
+	if v2 {
+		result.ContinuationToken = query.Get("continuation-token")
+	} else {
+		result.Marker = query.Get("marker")
+	}
+	last, lastIsPrefix := "", false
+	for _, key := range sortedKeys(objects) {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+		commonPrefix := ""
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				commonPrefix = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if commonPrefix != "" && commonPrefix == last {
+			continue
+		}
+		if len(result.Contents)+len(result.CommonPrefixes) == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, listPrefix{commonPrefix})
+			last, lastIsPrefix = commonPrefix, true
+			continue
+		}
+		obj := objects[key]
+		result.Contents = append(result.Contents, listContent{
+			Key:          key,
+			LastModified: obj.lastModified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+		last, lastIsPrefix = key, false
+	}
+	if result.IsTruncated {
+		// The next page starts after all the keys of the last common prefix,
+		// with a marker ending in the highest rune
+		next := last
+		if lastIsPrefix {
+			next = last + string(rune(utf8.MaxRune))
+		}
+		if v2 {
+			result.NextContinuationToken = next
+		} else if delimiter != "" {
+			result.NextMarker = next
+		}
+	}
+	if v2 {
+		result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	}
+	writeXML(w, result)
+	return nil
+}
+
+// deleteObjects serves DeleteObjects
+func (f *FakeS3) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	var request struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+		Quiet bool
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		return &fakeError{http.StatusBadRequest, "MalformedXML", err.Error()}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	objects := f.buckets[bucket]
+	if objects == nil {
+		return errNoSuchBucket(bucket)
+	}
+	type deleted struct {
+		Key string
+	}
+	result := struct {
+		XMLName xml.Name  `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+		Deleted []deleted `xml:"Deleted"`
+	}{}
+	for _, obj := range request.Objects {
+		delete(objects, obj.Key)
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, deleted{obj.Key})
+		}
+	}
+	writeXML(w, result)
+	return nil
+}
+
+func (f *FakeS3) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if len(query) != 0 && !query.Has("partNumber") && !query.Has("x-id") {
+			return errNotImplemented(r)
+		}
+		return f.getObject(w, r, bucket, key)
+	case http.MethodPut:
+		switch {
+		case query.Has("uploadId"):
+			return f.uploadPart(w, r, bucket, key, query)
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			return f.copyObject(w, r, bucket, key)
+		case len(query) == 0 || query.Has("x-id"):
+			return f.putObject(w, r, bucket, key)
+		}
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			return f.createMultipartUpload(w, r, bucket, key)
+		case query.Has("uploadId"):
+			return f.completeMultipartUpload(w, r, bucket, key, query.Get("uploadId"))
+		}
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			return f.abortMultipartUpload(w, query.Get("uploadId"))
+		}
+		if len(query) == 0 || query.Has("x-id") {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.buckets[bucket] == nil {
+				return errNoSuchBucket(bucket)
+			}
+			delete(f.buckets[bucket], key)
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return errNotImplemented(r)
+}
+
+// lookup returns the object key of bucket. f.mu must be held
+func (f *FakeS3) lookup(bucket, key string) (*fakeObject, error) {
+	objects := f.buckets[bucket]
+	if objects == nil {
+		return nil, errNoSuchBucket(bucket)
+	}
+	obj := objects[key]
+	if obj == nil {
+		return nil, errNoSuchKey(key)
+	}
+	return obj, nil
+}
+
+// getObject serves GetObject and HeadObject, with ranges and conditions
+func (f *FakeS3) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	f.mu.Lock()
+	obj, err := f.lookup(bucket, key)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	header := w.Header()
+	header.Set("ETag", obj.etag)
+	header.Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+	if match := r.Header.Get("If-Match"); match != "" && match != obj.etag {
+		return &fakeError{http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold"}
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == obj.etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !obj.lastModified.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	header.Set("Content-Type", obj.contentType)
+	header.Set("Accept-Ranges", "bytes")
+	for name, values := range obj.metadata {
+		header[name] = values
+	}
+	data := obj.data
+	status := http.StatusOK
+	if partNumber := r.URL.Query().Get("partNumber"); partNumber != "" {
+		start, end, ok := partRange(obj, partNumber)
+		if !ok {
+			return &fakeError{http.StatusRequestedRangeNotSatisfiable, "InvalidPartNumber", "The requested partnumber is not satisfiable"}
+		}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		header.Set("X-Amz-Mp-Parts-Count", strconv.Itoa(max(len(obj.partSizes), 1)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	} else if rng := r.Header.Get("Range"); rng != "" {
+		start, end, ok := parseRange(rng, int64(len(data)))
+		if !ok {
+			return &fakeError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+		}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+		status = http.StatusPartialContent
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+	return nil
+}
+
+// partRange returns the first and last byte of the part partNumber of obj. An object
+// not created by a multipart upload has a single part
+func partRange(obj *fakeObject, partNumber string) (int, int, bool) {
+	n, err := strconv.Atoi(partNumber)
+	sizes := obj.partSizes
+	if sizes == nil {
+		sizes = []int{len(obj.data)}
+	}
+	if err != nil || n < 1 || n > len(sizes) || len(obj.data) == 0 {
+		return 0, 0, false
+	}
+	start := 0
+	for _, size := range sizes[:n-1] {
+		start += size
+	}
+	return start, start + sizes[n-1] - 1, true
+}
+
+// parseRange returns the first and last byte of the range header rng of a content of size bytes
+func parseRange(rng string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, size > 0
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// readBody returns the content of the body of r, decoding the aws-chunked encoding of streamed uploads
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return io.ReadAll(r.Body)
+	}
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid aws-chunked chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk[:size]...)
+	}
+}
+
+// userMetadata returns the x-amz-meta-* headers of r
+func userMetadata(r *http.Request) http.Header {
+	metadata := make(http.Header)
+	for name, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			metadata[name] = values
+		}
+	}
+	return metadata
+}
+
+// checkAbsent returns an error if r only writes an absent object, with If-None-Match, and it exists.
+// f.mu must be held
+func (f *FakeS3) checkAbsent(r *http.Request, bucket, key string) error {
+	if r.Header.Get("If-None-Match") == "*" && f.buckets[bucket][key] != nil {
+		return &fakeError{http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold"}
+	}
+	return nil
+}
+
+// putObject serves PutObject
+func (f *FakeS3) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	data, err := readBody(r)
+	if err != nil {
+		return &fakeError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.buckets[bucket] == nil {
+		return errNoSuchBucket(bucket)
+	}
+	if err := f.checkAbsent(r, bucket, key); err != nil {
+		return err
+	}
+	obj := newFakeObject(data, r.Header.Get("Content-Type"), userMetadata(r))
+	f.buckets[bucket][key] = obj
+	w.Header().Set("ETag", obj.etag)
+	return nil
+}
+
+// copySource returns the object copied by r
+func (f *FakeS3) copySource(r *http.Request) (*fakeObject, error) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return nil, &fakeError{http.StatusBadRequest, "InvalidArgument", err.Error()}
+	}
+	source, _, _ = strings.Cut(source, "?versionId=")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookup(srcBucket, srcKey)
+}
+
+// copyObject serves CopyObject
+func (f *FakeS3) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	src, err := f.copySource(r)
+	if err != nil {
+		return err
+	}
+	contentType, metadata := src.contentType, src.metadata
+	if r.Header.Get("X-Amz-Metadata-Directive") == "REPLACE" {
+		contentType, metadata = r.Header.Get("Content-Type"), userMetadata(r)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.buckets[bucket] == nil {
+		return errNoSuchBucket(bucket)
+	}
+	obj := newFakeObject(src.data, contentType, metadata)
+	f.buckets[bucket][key] = obj
+	writeXML(w, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: obj.etag, LastModified: obj.lastModified.Format("2006-01-02T15:04:05.000Z")})
+	return nil
+}
+
+// createMultipartUpload serves CreateMultipartUpload
+func (f *FakeS3) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.buckets[bucket] == nil {
+		return errNoSuchBucket(bucket)
+	}
+	f.nextID++
+	uploadID := fmt.Sprintf("upload-%d", f.nextID)
+	f.uploads[uploadID] = &fakeUpload{
+		bucket:      bucket,
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		metadata:    userMetadata(r),
+		parts:       make(map[int]*fakeObject),
+	}
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Bucket: bucket, Key: key, UploadId: uploadID})
+	return nil
+}
+
+func errNoSuchUpload(uploadID string) error {
+	return &fakeError{http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist: " + uploadID}
+}
+
+// uploadPart serves UploadPart and UploadPartCopy
+func (f *FakeS3) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key string, query url.Values) error {
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		return &fakeError{http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000"}
+	}
+
+	var data []byte
+	copied := r.Header.Get("X-Amz-Copy-Source") != ""
+	if copied {
+		src, err := f.copySource(r)
+		if err != nil {
+			return err
+		}
+		data = src.data
+		if rng := r.Header.Get("X-Amz-Copy-Source-Range"); rng != "" {
+			start, end, ok := parseRange(rng, int64(len(data)))
+			if !ok {
+				return &fakeError{http.StatusBadRequest, "InvalidArgument", "The copy source range is not valid"}
+			}
+			data = data[start : end+1]
+		}
+	} else if data, err = readBody(r); err != nil {
+		return &fakeError{http.StatusBadRequest, "IncompleteBody", err.Error()}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload := f.uploads[query.Get("uploadId")]
+	if upload == nil || upload.bucket != bucket || upload.key != key {
+		return errNoSuchUpload(query.Get("uploadId"))
+	}
+	part := newFakeObject(data, "", nil)
+	upload.parts[partNumber] = part
+	if copied {
+		writeXML(w, struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			ETag         string
+			LastModified string
+		}{ETag: part.etag, LastModified: part.lastModified.Format("2006-01-02T15:04:05.000Z")})
+		return nil
+	}
+	w.Header().Set("ETag", part.etag)
+	return nil
+}
+
+// completeMultipartUpload serves CompleteMultipartUpload, with the ETag S3 computes for multipart
+// uploads: the MD5 of the MD5s of the parts, followed by the number of parts
+func (f *FakeS3) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		return &fakeError{http.StatusBadRequest, "MalformedXML", err.Error()}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	upload := f.uploads[uploadID]
+	if upload == nil || upload.bucket != bucket || upload.key != key {
+		return errNoSuchUpload(uploadID)
+	}
+	if err := f.checkAbsent(r, bucket, key); err != nil {
+		return err
+	}
+	var data, sums []byte
+	var partSizes []int
+	previous := 0
+	for _, p := range request.Parts {
+		part := upload.parts[p.PartNumber]
+		if part == nil || strings.Trim(p.ETag, `"`) != strings.Trim(part.etag, `"`) {
+			return &fakeError{http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d was not uploaded", p.PartNumber)}
+		}
+		if p.PartNumber <= previous {
+			return &fakeError{http.StatusBadRequest, "InvalidPartOrder", "The parts must be listed in ascending order"}
+		}
+		previous = p.PartNumber
+		data = append(data, part.data...)
+		partSizes = append(partSizes, len(part.data))
+		sum, _ := hex.DecodeString(strings.Trim(part.etag, `"`))
+		sums = append(sums, sum...)
+	}
+
+	obj := newFakeObject(data, upload.contentType, upload.metadata)
+	sum := md5.Sum(sums)
+	obj.etag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(request.Parts))
+	obj.partSizes = partSizes
+	f.buckets[bucket][key] = obj
+	delete(f.uploads, uploadID)
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Location: f.server.URL + "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: obj.etag})
+	return nil
+}
+
+// abortMultipartUpload serves AbortMultipartUpload
+func (f *FakeS3) abortMultipartUpload(w http.ResponseWriter, uploadID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.uploads[uploadID] == nil {
+		return errNoSuchUpload(uploadID)
+	}
+	delete(f.uploads, uploadID)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
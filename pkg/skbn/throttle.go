@@ -0,0 +1,65 @@
+package skbn
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// newBandwidthLimiter returns a limiter of bytesPerSecond shared by all the reads or writes
+// of a transfer, or nil if bytesPerSecond is zero
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+// waitBandwidth waits until limiter allows n more bytes, if limiter is set
+func waitBandwidth(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	// WaitN fails for more bytes than the burst, so wait for them one burst at a time
+	for n > 0 {
+		chunk := n
+		if burst := limiter.Burst(); chunk > burst {
+			chunk = burst
+		}
+		if err := limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// throttledReader limits the rate at which r is read
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if wErr := waitBandwidth(tr.ctx, tr.limiter, n); wErr != nil && err == nil {
+		err = wErr
+	}
+	return n, err
+}
+
+// throttledWriterAt limits the rate at which w is written. It is safe for concurrent use if w is
+type throttledWriterAt struct {
+	ctx     context.Context
+	w       io.WriterAt
+	limiter *rate.Limiter
+}
+
+func (tw *throttledWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := waitBandwidth(tw.ctx, tw.limiter, len(p)); err != nil {
+		return 0, err
+	}
+	return tw.w.WriteAt(p, off)
+}
@@ -0,0 +1,48 @@
+package skbn
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the OpenTelemetry tracer of the spans of this package
+const tracerName = "github.com/unfernandito/skbn/pkg/skbn"
+
+// startSpan starts a span of an operation on bucket and key, as a child of the span of ctx.
+// Nothing is started unless the span of ctx is recording, so that tracing costs nothing
+// when no tracer is configured
+func startSpan(ctx context.Context, name, bucket, key string) (context.Context, trace.Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.IsRecording() {
+		return ctx, parent
+	}
+	return parent.TracerProvider().Tracer(tracerName).Start(ctx, name, trace.WithAttributes(
+		attribute.String("s3.bucket", bucket),
+		attribute.String("s3.key", key),
+	))
+}
+
+// endSpan records the outcome of an operation in span and ends it
+func endSpan(span trace.Span, bytes int64, attempts int, err error) {
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int64("skbn.bytes", bytes),
+		attribute.Int("skbn.attempts", attempts),
+	)
+	if err != nil {
+		if requestID, hostID := RequestIDs(err); requestID != "" || hostID != "" {
+			span.SetAttributes(
+				attribute.String("aws.request_id", requestID),
+				attribute.String("aws.extended_request_id", hostID),
+			)
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"log"
 	"os"
 	"strconv"
@@ -55,3 +56,21 @@ func LeftPad2Len(num, padNum, overallLen int) string {
 func Sleep(seconds int) {
 	time.Sleep(time.Duration(seconds) * time.Second)
 }
+
+// SleepWithContext sleeps for an input number of seconds or until ctx is done
+func SleepWithContext(ctx context.Context, seconds int) error {
+	return SleepDurationWithContext(ctx, time.Duration(seconds)*time.Second)
+}
+
+// SleepDurationWithContext sleeps for an input duration or until ctx is done
+func SleepDurationWithContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
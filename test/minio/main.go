@@ -0,0 +1,101 @@
+// Command minio checks uploads, downloads, listings and deletes against a MinIO server.
+// It is run by `make test-minio`, which starts a MinIO container, and needs the endpoint
+// and credentials of the server in AWS_S3_ENDPOINT, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/unfernandito/skbn/pkg/skbn"
+)
+
+const bucket = "skbn-integration"
+
+func main() {
+	endpoint := os.Getenv("AWS_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:9000"
+	}
+	ctx := context.Background()
+
+	config := skbn.MinIOConfig(endpoint)
+	config.ConnectionCheck = skbn.S3ConnectionCheckNone
+	client, err := skbn.NewS3Client(ctx, bucket, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := createBucket(ctx, client.Service()); err != nil {
+		log.Fatal(err)
+	}
+
+	// A small file is uploaded with a single request, a large one with a multipart upload.
+	// Keys with characters to escape in URLs and unicode must come back unchanged
+	files := map[string][]byte{
+		"small.txt":               []byte("hello from skbn"),
+		"dir/large.bin":           bytes.Repeat([]byte("0123456789abcdef"), 768*1024),
+		"my file #1 (draft)?.txt": []byte("a key with spaces, # and ?"),
+		"a+b/файл.txt":            []byte("a unicode key"),
+	}
+	for name, content := range files {
+		_, err := client.Upload(ctx, bucket+"/"+name, name, bytes.NewReader(content), skbn.S3UploadOptions{
+			PartSize: 5 * 1024 * 1024,
+			Size:     int64(len(content)),
+		})
+		if err != nil {
+			log.Fatalf("upload %s: %v", name, err)
+		}
+
+		var got bytes.Buffer
+		if _, err := client.Download(ctx, bucket+"/"+name, &got, skbn.S3DownloadOptions{VerifyChecksum: true}); err != nil {
+			log.Fatalf("download %s: %v", name, err)
+		}
+		if !bytes.Equal(got.Bytes(), content) {
+			log.Fatalf("download %s: got %d bytes, want %d", name, got.Len(), len(content))
+		}
+	}
+
+	keys, err := skbn.GetListOfFilesFromS3(ctx, client, bucket)
+	if err != nil {
+		log.Fatalf("list: %v", err)
+	}
+	if len(keys) != len(files) {
+		log.Fatalf("list: got %v, want %d files", keys, len(files))
+	}
+	for _, key := range keys {
+		if _, ok := files[key]; !ok {
+			log.Fatalf("list: got unexpected key %q", key)
+		}
+	}
+
+	if _, err := client.DeletePrefix(ctx, bucket, skbn.S3DeleteOptions{}); err != nil {
+		log.Fatalf("delete: %v", err)
+	}
+	if _, err := client.Stat(ctx, bucket+"/small.txt"); !errors.Is(err, skbn.ErrNotFound) {
+		log.Fatalf("stat after delete: got %v, want %v", err, skbn.ErrNotFound)
+	}
+
+	fmt.Println("MinIO integration test passed")
+}
+
+// createBucket creates the bucket of the test, waiting for the server to start
+func createBucket(ctx context.Context, svc *s3.Client) error {
+	var err error
+	for i := 0; i < 30; i++ {
+		_, err = svc.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(bucket)})
+		var owned *types.BucketAlreadyOwnedByYou
+		if err == nil || errors.As(err, &owned) {
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("could not create bucket %s: %w", bucket, err)
+}